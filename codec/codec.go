@@ -0,0 +1,118 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	JSONName        = "json"
+	GobName         = "gob"
+	ProtobufName    = "protobuf"
+	MessagePackName = "msgpack"
+)
+
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+type JSON struct{}
+
+func (JSON) Name() string {
+	return JSONName
+}
+
+func (JSON) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSON) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type Gob struct{}
+
+func (Gob) Name() string {
+	return GobName
+}
+
+func (Gob) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (Gob) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type MessagePack struct{}
+
+func (MessagePack) Name() string {
+	return MessagePackName
+}
+
+func (MessagePack) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MessagePack) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+type Protobuf struct{}
+
+func (Protobuf) Name() string {
+	return ProtobufName
+}
+
+func (Protobuf) Marshal(v any) ([]byte, error) {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec: %T does not implement proto.Message", v)
+	}
+	return proto.Marshal(message)
+}
+
+func (Protobuf) Unmarshal(data []byte, v any) error {
+	if message, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, message)
+	}
+
+	// Messages are usually declared as pointer types, so v is a pointer to a (possibly nil) message pointer.
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Pointer {
+		return fmt.Errorf("protobuf codec: %T does not point to a proto.Message", v)
+	}
+	target := rv.Elem()
+	if target.IsNil() {
+		target.Set(reflect.New(target.Type().Elem()))
+	}
+	message, ok := target.Interface().(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf codec: %T does not point to a proto.Message", v)
+	}
+	return proto.Unmarshal(data, message)
+}
+
+var builtins = map[string]Codec{
+	JSONName:        JSON{},
+	GobName:         Gob{},
+	ProtobufName:    Protobuf{},
+	MessagePackName: MessagePack{},
+}
+
+func ByName(name string) (Codec, bool) {
+	c, found := builtins[name]
+	return c, found
+}
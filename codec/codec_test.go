@@ -0,0 +1,105 @@
+package codec
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type testMessage struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	tests := []struct {
+		codec Codec
+		name  string
+	}{
+		{name: JSONName, codec: JSON{}},
+		{name: GobName, codec: Gob{}},
+		{name: MessagePackName, codec: MessagePack{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.codec.Name() != tt.name {
+				t.Errorf("Name() = %s, want %s", tt.codec.Name(), tt.name)
+			}
+
+			input := testMessage{Name: "test", Count: 3}
+			data, err := tt.codec.Marshal(input)
+			if err != nil {
+				t.Fatalf("Marshal returned error: %v", err)
+			}
+
+			var output testMessage
+			err = tt.codec.Unmarshal(data, &output)
+			if err != nil {
+				t.Fatalf("Unmarshal returned error: %v", err)
+			}
+			if output != input {
+				t.Errorf("Unmarshal = %+v, want %+v", output, input)
+			}
+		})
+	}
+}
+
+func TestProtobuf_RoundTrip(t *testing.T) {
+	c := Protobuf{}
+
+	data, err := c.Marshal(wrapperspb.String("hello"))
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+
+	var pointerTarget *wrapperspb.StringValue
+	err = c.Unmarshal(data, &pointerTarget)
+	if err != nil {
+		t.Fatalf("Unmarshal into pointer returned error: %v", err)
+	}
+	if pointerTarget.GetValue() != "hello" {
+		t.Errorf("Value = %s, want hello", pointerTarget.GetValue())
+	}
+
+	directTarget := &wrapperspb.StringValue{}
+	err = c.Unmarshal(data, directTarget)
+	if err != nil {
+		t.Fatalf("Unmarshal into message returned error: %v", err)
+	}
+	if directTarget.GetValue() != "hello" {
+		t.Errorf("Value = %s, want hello", directTarget.GetValue())
+	}
+}
+
+func TestProtobuf_NonProtoMessage(t *testing.T) {
+	c := Protobuf{}
+
+	_, err := c.Marshal(testMessage{})
+	if err == nil {
+		t.Error("Marshal should fail for non proto message")
+	}
+
+	var target testMessage
+	err = c.Unmarshal([]byte{}, &target)
+	if err == nil {
+		t.Error("Unmarshal should fail for non proto target")
+	}
+}
+
+func TestByName(t *testing.T) {
+	for _, name := range []string{JSONName, GobName, ProtobufName, MessagePackName} {
+		c, found := ByName(name)
+		if !found {
+			t.Errorf("ByName(%s) not found", name)
+			continue
+		}
+		if c.Name() != name {
+			t.Errorf("ByName(%s).Name() = %s", name, c.Name())
+		}
+	}
+
+	if _, found := ByName("unknown"); found {
+		t.Error("ByName(unknown) should not be found")
+	}
+}
@@ -1,13 +1,45 @@
 package config
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/halilbulentorhon/cb-pubsub/constant"
+)
+
+const (
+	minSelfDocTtlPollRatio = 3
+	minPollInterval        = 10 * time.Millisecond
+)
+
 type PubSubConfig struct {
-	CouchbaseConfig        CouchbaseConfig `json:"couchbaseConfig"`
-	PollIntervalSeconds    int             `json:"pollIntervalSeconds"`
-	CleanupIntervalSeconds int             `json:"cleanupIntervalSeconds"`
-	SubscribeRetryAttempts int             `json:"subscribeRetryAttempts"`
-	CleanupRetryAttempts   int             `json:"cleanupRetryAttempts"`
-	ShutdownTimeoutSec     int             `json:"shutdownTimeoutSec"`
-	InitTimeoutSec         int             `json:"initTimeoutSec"`
+	CouchbaseConfig           CouchbaseConfig `json:"couchbaseConfig"`
+	PollIntervalSeconds       int             `json:"pollIntervalSeconds"`
+	MinPollInterval           time.Duration   `json:"minPollInterval"`
+	MaxPollInterval           time.Duration   `json:"maxPollInterval"`
+	CleanupIntervalSeconds    int             `json:"cleanupIntervalSeconds"`
+	SubscribeRetryAttempts    int             `json:"subscribeRetryAttempts"`
+	CleanupRetryAttempts      int             `json:"cleanupRetryAttempts"`
+	ShutdownTimeoutSec        int             `json:"shutdownTimeoutSec"`
+	InitTimeoutSec            int             `json:"initTimeoutSec"`
+	Compression               string          `json:"compression"`
+	CompressionThresholdBytes int             `json:"compressionThresholdBytes"`
+	OverflowThresholdBytes    int             `json:"overflowThresholdBytes"`
+	OverflowChunkBytes        int             `json:"overflowChunkBytes"`
+	OverflowTtlSeconds        int             `json:"overflowTtlSeconds"`
+	MaxQueueDepth             int             `json:"maxQueueDepth"`
+	QueueFullPolicy           string          `json:"queueFullPolicy"`
+	MaxBatchSize              int             `json:"maxBatchSize"`
+	HandlerConcurrency        int             `json:"handlerConcurrency"`
+	HandlerTimeoutSec         int             `json:"handlerTimeoutSec"`
+	HeartbeatIntervalSeconds  int             `json:"heartbeatIntervalSeconds"`
+	HeartbeatTimeoutSeconds   int             `json:"heartbeatTimeoutSeconds"`
+	SelfDocTtlSeconds         int             `json:"selfDocTtlSeconds"`
+	MaxConsecutiveFailures    int             `json:"maxConsecutiveFailures"`
+	CleanupBackoffMultiplier  float64         `json:"cleanupBackoffMultiplier"`
+	MaxCleanupInterval        time.Duration   `json:"maxCleanupInterval"`
+	ReconcileIntervalSeconds  int             `json:"reconcileIntervalSeconds"`
+	HandleSignals             bool            `json:"handleSignals"`
 }
 
 type CouchbaseConfig struct {
@@ -25,6 +57,12 @@ func (c *PubSubConfig) ApplyDefaults() {
 	if c.PollIntervalSeconds <= 0 {
 		c.PollIntervalSeconds = 1
 	}
+	if c.MinPollInterval <= 0 {
+		c.MinPollInterval = time.Duration(c.PollIntervalSeconds) * time.Second
+	}
+	if c.MaxPollInterval == 0 {
+		c.MaxPollInterval = c.MinPollInterval
+	}
 	if c.CleanupIntervalSeconds <= 0 {
 		c.CleanupIntervalSeconds = 15
 	}
@@ -46,4 +84,67 @@ func (c *PubSubConfig) ApplyDefaults() {
 	if c.InitTimeoutSec <= 0 {
 		c.InitTimeoutSec = 30
 	}
+	if c.CompressionThresholdBytes <= 0 {
+		c.CompressionThresholdBytes = 1024
+	}
+	if c.OverflowChunkBytes <= 0 {
+		c.OverflowChunkBytes = 8 * 1024 * 1024
+	}
+	if c.OverflowTtlSeconds <= 0 {
+		c.OverflowTtlSeconds = 3600
+	}
+	if c.HandlerConcurrency <= 0 {
+		c.HandlerConcurrency = 1
+	}
+	if c.HandlerTimeoutSec <= 0 {
+		c.HandlerTimeoutSec = 30
+	}
+	if c.HeartbeatIntervalSeconds <= 0 {
+		c.HeartbeatIntervalSeconds = 10
+	}
+	if c.HeartbeatTimeoutSeconds <= 0 {
+		c.HeartbeatTimeoutSeconds = c.HeartbeatIntervalSeconds * 3
+	}
+	if c.SelfDocTtlSeconds <= 0 {
+		c.SelfDocTtlSeconds = 600
+	}
+	if c.MaxConsecutiveFailures <= 0 {
+		c.MaxConsecutiveFailures = 10
+	}
+	if c.CleanupBackoffMultiplier <= 0 {
+		c.CleanupBackoffMultiplier = 1.5
+	}
+	if c.MaxCleanupInterval <= 0 {
+		c.MaxCleanupInterval = 5 * time.Minute
+	}
+	if c.ReconcileIntervalSeconds <= 0 {
+		c.ReconcileIntervalSeconds = 300
+	}
+	if c.QueueFullPolicy == "" {
+		c.QueueFullPolicy = constant.QueueFullPolicyDropOldest
+	}
+}
+
+func (c *PubSubConfig) Validate() error {
+	if c.MinPollInterval < minPollInterval {
+		return fmt.Errorf("min poll interval %s must be at least %s, durations are read from JSON as nanoseconds", c.MinPollInterval, minPollInterval)
+	}
+	if c.MaxPollInterval < c.MinPollInterval {
+		return fmt.Errorf("max poll interval %s must not be less than the min poll interval %s", c.MaxPollInterval, c.MinPollInterval)
+	}
+	selfDocTtl := time.Duration(c.SelfDocTtlSeconds) * time.Second
+	if selfDocTtl < minSelfDocTtlPollRatio*c.MaxPollInterval {
+		return fmt.Errorf("self document ttl %s must be at least %d times the max poll interval %s", selfDocTtl, minSelfDocTtlPollRatio, c.MaxPollInterval)
+	}
+	if c.HeartbeatTimeoutSeconds <= c.HeartbeatIntervalSeconds {
+		return fmt.Errorf("heartbeat timeout %ds must be greater than the heartbeat interval %ds", c.HeartbeatTimeoutSeconds, c.HeartbeatIntervalSeconds)
+	}
+	if c.CleanupBackoffMultiplier < 1 {
+		return fmt.Errorf("cleanup backoff multiplier %v must not be less than 1", c.CleanupBackoffMultiplier)
+	}
+	cleanupInterval := time.Duration(c.CleanupIntervalSeconds) * time.Second
+	if c.MaxCleanupInterval < cleanupInterval {
+		return fmt.Errorf("max cleanup interval %s must not be less than the cleanup interval %s", c.MaxCleanupInterval, cleanupInterval)
+	}
+	return nil
 }
@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 )
 
 func TestPubSubConfig_ApplyDefaults(t *testing.T) {
@@ -14,10 +15,25 @@ func TestPubSubConfig_ApplyDefaults(t *testing.T) {
 			name:  "empty config gets all defaults",
 			input: PubSubConfig{},
 			expected: PubSubConfig{
-				PollIntervalSeconds:    1,
-				CleanupIntervalSeconds: 15,
-				SubscribeRetryAttempts: 3,
-				CleanupRetryAttempts:   5,
+				PollIntervalSeconds:       1,
+				MinPollInterval:           time.Second,
+				MaxPollInterval:           time.Second,
+				CleanupIntervalSeconds:    15,
+				SubscribeRetryAttempts:    3,
+				CleanupRetryAttempts:      5,
+				CompressionThresholdBytes: 1024,
+				OverflowChunkBytes:        8 * 1024 * 1024,
+				OverflowTtlSeconds:        3600,
+				QueueFullPolicy:           "drop-oldest",
+				HandlerConcurrency:        1,
+				HandlerTimeoutSec:         30,
+				HeartbeatIntervalSeconds:  10,
+				HeartbeatTimeoutSeconds:   30,
+				SelfDocTtlSeconds:         600,
+				MaxConsecutiveFailures:    10,
+				CleanupBackoffMultiplier:  1.5,
+				MaxCleanupInterval:        5 * time.Minute,
+				ReconcileIntervalSeconds:  300,
 				CouchbaseConfig: CouchbaseConfig{
 					ConnectTimeoutSec:   10,
 					OperationTimeoutSec: 5,
@@ -35,10 +51,25 @@ func TestPubSubConfig_ApplyDefaults(t *testing.T) {
 				},
 			},
 			expected: PubSubConfig{
-				PollIntervalSeconds:    5,
-				CleanupIntervalSeconds: 15,
-				SubscribeRetryAttempts: 3,
-				CleanupRetryAttempts:   5,
+				PollIntervalSeconds:       5,
+				MinPollInterval:           5 * time.Second,
+				MaxPollInterval:           5 * time.Second,
+				CleanupIntervalSeconds:    15,
+				SubscribeRetryAttempts:    3,
+				CleanupRetryAttempts:      5,
+				CompressionThresholdBytes: 1024,
+				OverflowChunkBytes:        8 * 1024 * 1024,
+				OverflowTtlSeconds:        3600,
+				QueueFullPolicy:           "drop-oldest",
+				HandlerConcurrency:        1,
+				HandlerTimeoutSec:         30,
+				HeartbeatIntervalSeconds:  10,
+				HeartbeatTimeoutSeconds:   30,
+				SelfDocTtlSeconds:         600,
+				MaxConsecutiveFailures:    10,
+				CleanupBackoffMultiplier:  1.5,
+				MaxCleanupInterval:        5 * time.Minute,
+				ReconcileIntervalSeconds:  300,
 				CouchbaseConfig: CouchbaseConfig{
 					Host:                "localhost",
 					Username:            "admin",
@@ -61,10 +92,89 @@ func TestPubSubConfig_ApplyDefaults(t *testing.T) {
 				},
 			},
 			expected: PubSubConfig{
-				PollIntervalSeconds:    1,
-				CleanupIntervalSeconds: 15,
-				SubscribeRetryAttempts: 3,
-				CleanupRetryAttempts:   5,
+				PollIntervalSeconds:       1,
+				MinPollInterval:           time.Second,
+				MaxPollInterval:           time.Second,
+				CleanupIntervalSeconds:    15,
+				SubscribeRetryAttempts:    3,
+				CleanupRetryAttempts:      5,
+				CompressionThresholdBytes: 1024,
+				OverflowChunkBytes:        8 * 1024 * 1024,
+				OverflowTtlSeconds:        3600,
+				QueueFullPolicy:           "drop-oldest",
+				HandlerConcurrency:        1,
+				HandlerTimeoutSec:         30,
+				HeartbeatIntervalSeconds:  10,
+				HeartbeatTimeoutSeconds:   30,
+				SelfDocTtlSeconds:         600,
+				MaxConsecutiveFailures:    10,
+				CleanupBackoffMultiplier:  1.5,
+				MaxCleanupInterval:        5 * time.Minute,
+				ReconcileIntervalSeconds:  300,
+				CouchbaseConfig: CouchbaseConfig{
+					ConnectTimeoutSec:   10,
+					OperationTimeoutSec: 5,
+				},
+			},
+		},
+		{
+			name: "adaptive poll interval bounds",
+			input: PubSubConfig{
+				MinPollInterval: 100 * time.Millisecond,
+				MaxPollInterval: 5 * time.Second,
+			},
+			expected: PubSubConfig{
+				PollIntervalSeconds:       1,
+				MinPollInterval:           100 * time.Millisecond,
+				MaxPollInterval:           5 * time.Second,
+				CleanupIntervalSeconds:    15,
+				SubscribeRetryAttempts:    3,
+				CleanupRetryAttempts:      5,
+				CompressionThresholdBytes: 1024,
+				OverflowChunkBytes:        8 * 1024 * 1024,
+				OverflowTtlSeconds:        3600,
+				QueueFullPolicy:           "drop-oldest",
+				HandlerConcurrency:        1,
+				HandlerTimeoutSec:         30,
+				HeartbeatIntervalSeconds:  10,
+				HeartbeatTimeoutSeconds:   30,
+				SelfDocTtlSeconds:         600,
+				MaxConsecutiveFailures:    10,
+				CleanupBackoffMultiplier:  1.5,
+				MaxCleanupInterval:        5 * time.Minute,
+				ReconcileIntervalSeconds:  300,
+				CouchbaseConfig: CouchbaseConfig{
+					ConnectTimeoutSec:   10,
+					OperationTimeoutSec: 5,
+				},
+			},
+		},
+		{
+			name: "explicit heartbeat timeout is kept",
+			input: PubSubConfig{
+				HeartbeatIntervalSeconds: 20,
+				HeartbeatTimeoutSeconds:  15,
+			},
+			expected: PubSubConfig{
+				PollIntervalSeconds:       1,
+				MinPollInterval:           time.Second,
+				MaxPollInterval:           time.Second,
+				CleanupIntervalSeconds:    15,
+				SubscribeRetryAttempts:    3,
+				CleanupRetryAttempts:      5,
+				CompressionThresholdBytes: 1024,
+				OverflowChunkBytes:        8 * 1024 * 1024,
+				OverflowTtlSeconds:        3600,
+				QueueFullPolicy:           "drop-oldest",
+				HandlerConcurrency:        1,
+				HandlerTimeoutSec:         30,
+				HeartbeatIntervalSeconds:  20,
+				HeartbeatTimeoutSeconds:   15,
+				SelfDocTtlSeconds:         600,
+				MaxConsecutiveFailures:    10,
+				CleanupBackoffMultiplier:  1.5,
+				MaxCleanupInterval:        5 * time.Minute,
+				ReconcileIntervalSeconds:  300,
 				CouchbaseConfig: CouchbaseConfig{
 					ConnectTimeoutSec:   10,
 					OperationTimeoutSec: 5,
@@ -81,6 +191,12 @@ func TestPubSubConfig_ApplyDefaults(t *testing.T) {
 			if cfg.PollIntervalSeconds != tt.expected.PollIntervalSeconds {
 				t.Errorf("PollIntervalSeconds = %d, want %d", cfg.PollIntervalSeconds, tt.expected.PollIntervalSeconds)
 			}
+			if cfg.MinPollInterval != tt.expected.MinPollInterval {
+				t.Errorf("MinPollInterval = %v, want %v", cfg.MinPollInterval, tt.expected.MinPollInterval)
+			}
+			if cfg.MaxPollInterval != tt.expected.MaxPollInterval {
+				t.Errorf("MaxPollInterval = %v, want %v", cfg.MaxPollInterval, tt.expected.MaxPollInterval)
+			}
 			if cfg.CleanupIntervalSeconds != tt.expected.CleanupIntervalSeconds {
 				t.Errorf("CleanupIntervalSeconds = %d, want %d", cfg.CleanupIntervalSeconds, tt.expected.CleanupIntervalSeconds)
 			}
@@ -90,6 +206,45 @@ func TestPubSubConfig_ApplyDefaults(t *testing.T) {
 			if cfg.CleanupRetryAttempts != tt.expected.CleanupRetryAttempts {
 				t.Errorf("CleanupRetryAttempts = %d, want %d", cfg.CleanupRetryAttempts, tt.expected.CleanupRetryAttempts)
 			}
+			if cfg.CompressionThresholdBytes != tt.expected.CompressionThresholdBytes {
+				t.Errorf("CompressionThresholdBytes = %d, want %d", cfg.CompressionThresholdBytes, tt.expected.CompressionThresholdBytes)
+			}
+			if cfg.OverflowChunkBytes != tt.expected.OverflowChunkBytes {
+				t.Errorf("OverflowChunkBytes = %d, want %d", cfg.OverflowChunkBytes, tt.expected.OverflowChunkBytes)
+			}
+			if cfg.OverflowTtlSeconds != tt.expected.OverflowTtlSeconds {
+				t.Errorf("OverflowTtlSeconds = %d, want %d", cfg.OverflowTtlSeconds, tt.expected.OverflowTtlSeconds)
+			}
+			if cfg.QueueFullPolicy != tt.expected.QueueFullPolicy {
+				t.Errorf("QueueFullPolicy = %s, want %s", cfg.QueueFullPolicy, tt.expected.QueueFullPolicy)
+			}
+			if cfg.HandlerConcurrency != tt.expected.HandlerConcurrency {
+				t.Errorf("HandlerConcurrency = %d, want %d", cfg.HandlerConcurrency, tt.expected.HandlerConcurrency)
+			}
+			if cfg.HandlerTimeoutSec != tt.expected.HandlerTimeoutSec {
+				t.Errorf("HandlerTimeoutSec = %d, want %d", cfg.HandlerTimeoutSec, tt.expected.HandlerTimeoutSec)
+			}
+			if cfg.HeartbeatIntervalSeconds != tt.expected.HeartbeatIntervalSeconds {
+				t.Errorf("HeartbeatIntervalSeconds = %d, want %d", cfg.HeartbeatIntervalSeconds, tt.expected.HeartbeatIntervalSeconds)
+			}
+			if cfg.HeartbeatTimeoutSeconds != tt.expected.HeartbeatTimeoutSeconds {
+				t.Errorf("HeartbeatTimeoutSeconds = %d, want %d", cfg.HeartbeatTimeoutSeconds, tt.expected.HeartbeatTimeoutSeconds)
+			}
+			if cfg.SelfDocTtlSeconds != tt.expected.SelfDocTtlSeconds {
+				t.Errorf("SelfDocTtlSeconds = %d, want %d", cfg.SelfDocTtlSeconds, tt.expected.SelfDocTtlSeconds)
+			}
+			if cfg.MaxConsecutiveFailures != tt.expected.MaxConsecutiveFailures {
+				t.Errorf("MaxConsecutiveFailures = %d, want %d", cfg.MaxConsecutiveFailures, tt.expected.MaxConsecutiveFailures)
+			}
+			if cfg.CleanupBackoffMultiplier != tt.expected.CleanupBackoffMultiplier {
+				t.Errorf("CleanupBackoffMultiplier = %v, want %v", cfg.CleanupBackoffMultiplier, tt.expected.CleanupBackoffMultiplier)
+			}
+			if cfg.MaxCleanupInterval != tt.expected.MaxCleanupInterval {
+				t.Errorf("MaxCleanupInterval = %v, want %v", cfg.MaxCleanupInterval, tt.expected.MaxCleanupInterval)
+			}
+			if cfg.ReconcileIntervalSeconds != tt.expected.ReconcileIntervalSeconds {
+				t.Errorf("ReconcileIntervalSeconds = %d, want %d", cfg.ReconcileIntervalSeconds, tt.expected.ReconcileIntervalSeconds)
+			}
 			if cfg.CouchbaseConfig.ConnectTimeoutSec != tt.expected.CouchbaseConfig.ConnectTimeoutSec {
 				t.Errorf("ConnectTimeoutSec = %d, want %d", cfg.CouchbaseConfig.ConnectTimeoutSec, tt.expected.CouchbaseConfig.ConnectTimeoutSec)
 			}
@@ -100,6 +255,105 @@ func TestPubSubConfig_ApplyDefaults(t *testing.T) {
 	}
 }
 
+func TestPubSubConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   PubSubConfig
+		wantErr bool
+	}{
+		{
+			name:  "defaults are valid",
+			input: PubSubConfig{},
+		},
+		{
+			name: "ttl of three max poll intervals is valid",
+			input: PubSubConfig{
+				SelfDocTtlSeconds: 30,
+				MaxPollInterval:   10 * time.Second,
+			},
+		},
+		{
+			name: "ttl too close to max poll interval",
+			input: PubSubConfig{
+				SelfDocTtlSeconds: 20,
+				MaxPollInterval:   10 * time.Second,
+			},
+			wantErr: true,
+		},
+		{
+			name: "sub-second min poll interval is valid",
+			input: PubSubConfig{
+				MinPollInterval: 50 * time.Millisecond,
+			},
+		},
+		{
+			name: "min poll interval decoded as nanoseconds",
+			input: PubSubConfig{
+				MinPollInterval: 500,
+			},
+			wantErr: true,
+		},
+		{
+			name: "max poll interval below min poll interval",
+			input: PubSubConfig{
+				MinPollInterval: time.Second,
+				MaxPollInterval: 500 * time.Millisecond,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative max poll interval",
+			input: PubSubConfig{
+				MaxPollInterval: -time.Second,
+			},
+			wantErr: true,
+		},
+		{
+			name: "heartbeat timeout equal to interval",
+			input: PubSubConfig{
+				HeartbeatIntervalSeconds: 10,
+				HeartbeatTimeoutSeconds:  10,
+			},
+			wantErr: true,
+		},
+		{
+			name: "heartbeat timeout below interval",
+			input: PubSubConfig{
+				HeartbeatIntervalSeconds: 20,
+				HeartbeatTimeoutSeconds:  15,
+			},
+			wantErr: true,
+		},
+		{
+			name: "cleanup backoff multiplier below one",
+			input: PubSubConfig{
+				CleanupBackoffMultiplier: 0.5,
+			},
+			wantErr: true,
+		},
+		{
+			name: "max cleanup interval below cleanup interval",
+			input: PubSubConfig{
+				CleanupIntervalSeconds: 60,
+				MaxCleanupInterval:     30 * time.Second,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.input
+			cfg.ApplyDefaults()
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestCouchbaseConfig_Fields(t *testing.T) {
 	cfg := CouchbaseConfig{
 		Host:                "couchbase://localhost",
@@ -3,17 +3,27 @@ package constant
 import "time"
 
 const (
-	AssignmentDocName = "_pubsub_all"
-	SelfDocPrefix     = "_pubsub_instance_"
-	MessagesPath      = "messages"
+	AssignmentDocName  = "_pubsub_all"
+	SelfDocPrefix      = "_pubsub_instance_"
+	BlobDocPrefix      = "_pubsub_blob_"
+	LeaderLeaseDocName = "_pubsub_leader"
+	MessagesPath       = "messages"
+	HeadSeqPath        = "headSeq"
+	FilterField        = "filter"
+	PausedField        = "paused"
+	TimestampField     = "timestamp"
 )
 
 const (
-	MaxConsecutiveFailures       = 10
-	CleanupIntervalMultiplier    = 1.5
-	MaxCleanupInterval           = 5 * time.Minute
-	SelfDocTtlSeconds            = 600
 	RemoveMultiplePathsBatchSize = 16
+	MaxSubDocSpecs               = 16
+	PollBackoffMultiplier        = 2.0
+	LeaderLeaseTtlMultiplier     = 3
+	MaxCasAttempts               = 10
+)
+
+const (
+	PodNameEnv = "POD_NAME"
 )
 
 const (
@@ -31,3 +41,15 @@ const (
 	DefaultCleanupRetryMaxDelay     = 30 * time.Second
 	DefaultCleanupRetryMultiplier   = 2.0
 )
+
+const (
+	CompressionGzip   = "gzip"
+	CompressionSnappy = "snappy"
+)
+
+const (
+	QueueFullPolicyDropOldest = "drop-oldest"
+	QueueFullPolicyDropNewest = "drop-newest"
+	QueueFullPolicyReject     = "reject"
+	QueueFullPolicyOverflow   = "overflow"
+)
@@ -26,11 +26,11 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to create PubSub: %v", err)
 	}
-	defer ps.Close()
+	defer ps.Close(context.Background())
 
 	// Start subscriber in background
 	go func() {
-		err = ps.Subscribe(context.Background(), func(messages []string) error {
+		err = ps.Subscribe(context.Background(), func(ctx context.Context, messages []string) error {
 			for _, msg := range messages {
 				fmt.Printf("Received: %s\n", msg)
 			}
@@ -68,6 +68,8 @@ func main() {
 	// Let messages be processed
 	time.Sleep(3 * time.Second)
 	fmt.Println("Example completed!")
-	ps.Close()
+	if err = ps.Close(context.Background()); err != nil {
+		log.Printf("Close error: %v", err)
+	}
 	time.Sleep(3 * time.Second)
 }
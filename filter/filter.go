@@ -0,0 +1,346 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const headersPrefix = "headers."
+
+type Filter struct {
+	root node
+	expr string
+}
+
+type node interface {
+	match(headers map[string]string, fields map[string]any) bool
+}
+
+type orNode struct {
+	left, right node
+}
+
+type andNode struct {
+	left, right node
+}
+
+type compareNode struct {
+	value  any
+	path   string
+	negate bool
+}
+
+func (n orNode) match(headers map[string]string, fields map[string]any) bool {
+	return n.left.match(headers, fields) || n.right.match(headers, fields)
+}
+
+func (n andNode) match(headers map[string]string, fields map[string]any) bool {
+	return n.left.match(headers, fields) && n.right.match(headers, fields)
+}
+
+func (n compareNode) match(headers map[string]string, fields map[string]any) bool {
+	actual, found := lookup(n.path, headers, fields)
+	equal := found && actual == n.value
+	if !found && n.value == nil {
+		equal = true
+	}
+	if n.negate {
+		return !equal
+	}
+	return equal
+}
+
+// Parse compiles expressions such as `tenant == "acme" && (headers.region == "eu" || priority != 0)`.
+// Identifiers prefixed with "headers." refer to publish headers, other identifiers are dotted
+// paths into the JSON form of the message.
+func Parse(expr string) (*Filter, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("filter expression is empty")
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token %q at position %d", p.tokens[p.pos].text, p.tokens[p.pos].pos)
+	}
+
+	return &Filter{root: root, expr: expr}, nil
+}
+
+func (f *Filter) Match(headers map[string]string, fields map[string]any) bool {
+	return f.root.match(headers, fields)
+}
+
+func (f *Filter) String() string {
+	return f.expr
+}
+
+func lookup(path string, headers map[string]string, fields map[string]any) (any, bool) {
+	if strings.HasPrefix(path, headersPrefix) {
+		value, found := headers[strings.TrimPrefix(path, headersPrefix)]
+		return value, found
+	}
+
+	var current any = fields
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current, ok = object[part]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenEqual
+	tokenNotEqual
+	tokenAnd
+	tokenOr
+	tokenLeftParen
+	tokenRightParen
+)
+
+type token struct {
+	text string
+	kind tokenKind
+	pos  int
+}
+
+func tokenize(expr string) ([]token, error) {
+	tokens := make([]token, 0)
+	for i := 0; i < len(expr); {
+		ch := expr[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "(", pos: i})
+			i++
+		case ch == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")", pos: i})
+			i++
+		case strings.HasPrefix(expr[i:], "=="):
+			tokens = append(tokens, token{kind: tokenEqual, text: "==", pos: i})
+			i += 2
+		case strings.HasPrefix(expr[i:], "!="):
+			tokens = append(tokens, token{kind: tokenNotEqual, text: "!=", pos: i})
+			i += 2
+		case strings.HasPrefix(expr[i:], "&&"):
+			tokens = append(tokens, token{kind: tokenAnd, text: "&&", pos: i})
+			i += 2
+		case strings.HasPrefix(expr[i:], "||"):
+			tokens = append(tokens, token{kind: tokenOr, text: "||", pos: i})
+			i += 2
+		case ch == '"':
+			end := i + 1
+			for end < len(expr) && expr[end] != '"' {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			text, err := strconv.Unquote(expr[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %w", i, err)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: i})
+			i = end + 1
+		case ch == '-' || isDigit(ch):
+			end := i + 1
+			for end < len(expr) && (isDigit(expr[end]) || expr[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: expr[i:end], pos: i})
+			i = end
+		case isIdentStart(ch):
+			end := i + 1
+			for end < len(expr) && (isIdentStart(expr[end]) || isDigit(expr[end]) || expr[end] == '.' || expr[end] == '-') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: expr[i:end], pos: i})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", ch, i)
+		}
+	}
+
+	return tokens, nil
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isIdentStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) next() (token, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return token{}, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	return tok, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind != tokenOr {
+			return left, nil
+		}
+		p.pos++
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind != tokenAnd {
+			return left, nil
+		}
+		p.pos++
+
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+}
+
+func (p *parser) parseTerm() (node, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.kind == tokenLeftParen {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing, err := p.next()
+		if err != nil || closing.kind != tokenRightParen {
+			return nil, fmt.Errorf("missing closing parenthesis for position %d", tok.pos)
+		}
+		return inner, nil
+	}
+
+	if tok.kind != tokenIdent {
+		return nil, fmt.Errorf("expected field or header name at position %d, got %q", tok.pos, tok.text)
+	}
+
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if op.kind != tokenEqual && op.kind != tokenNotEqual {
+		return nil, fmt.Errorf("expected == or != at position %d, got %q", op.pos, op.text)
+	}
+
+	literal, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseLiteral(literal)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(tok.text, headersPrefix) {
+		if _, isString := value.(string); !isString && value != nil {
+			return nil, fmt.Errorf("header %q can only be compared with a string at position %d", tok.text, literal.pos)
+		}
+	}
+
+	return compareNode{path: tok.text, value: value, negate: op.kind == tokenNotEqual}, nil
+}
+
+func parseLiteral(tok token) (any, error) {
+	switch tok.kind {
+	case tokenString:
+		return tok.text, nil
+	case tokenNumber:
+		number, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok.text, tok.pos)
+		}
+		return number, nil
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+
+	return nil, fmt.Errorf("expected literal at position %d, got %q", tok.pos, tok.text)
+}
+
+func FieldsOf(v any) map[string]any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	var fields map[string]any
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
@@ -0,0 +1,110 @@
+package filter
+
+import (
+	"testing"
+)
+
+func TestParse_Match(t *testing.T) {
+	headers := map[string]string{
+		"region": "eu",
+	}
+	fields := map[string]any{
+		"tenant":   "acme",
+		"priority": float64(2),
+		"urgent":   true,
+		"customer": map[string]any{
+			"tier": "gold",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected bool
+	}{
+		{name: "string equality", expr: `tenant == "acme"`, expected: true},
+		{name: "string inequality", expr: `tenant != "acme"`, expected: false},
+		{name: "number equality", expr: `priority == 2`, expected: true},
+		{name: "bool equality", expr: `urgent == true`, expected: true},
+		{name: "nested field", expr: `customer.tier == "gold"`, expected: true},
+		{name: "header equality", expr: `headers.region == "eu"`, expected: true},
+		{name: "missing header", expr: `headers.zone == "a"`, expected: false},
+		{name: "missing field equals null", expr: `missing == null`, expected: true},
+		{name: "missing field not equal", expr: `missing != "x"`, expected: true},
+		{name: "type mismatch", expr: `priority == "2"`, expected: false},
+		{name: "and", expr: `tenant == "acme" && priority == 3`, expected: false},
+		{name: "or", expr: `tenant == "other" || headers.region == "eu"`, expected: true},
+		{name: "and binds tighter than or", expr: `tenant == "other" && priority == 2 || urgent == true`, expected: true},
+		{name: "parentheses", expr: `tenant == "other" && (priority == 2 || urgent == true)`, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.expr, err)
+			}
+			if got := f.Match(headers, fields); got != tt.expected {
+				t.Errorf("Match(%q) = %v, want %v", tt.expr, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{name: "empty", expr: ""},
+		{name: "missing operator", expr: `tenant "acme"`},
+		{name: "missing literal", expr: `tenant ==`},
+		{name: "unterminated string", expr: `tenant == "acme`},
+		{name: "unbalanced parenthesis", expr: `(tenant == "acme"`},
+		{name: "trailing token", expr: `tenant == "acme" "x"`},
+		{name: "unknown character", expr: `tenant > 1`},
+		{name: "non string header", expr: `headers.region == 1`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			if err == nil {
+				t.Errorf("Parse(%q) should return error", tt.expr)
+			}
+		})
+	}
+}
+
+func TestFilter_NilInputs(t *testing.T) {
+	f, err := Parse(`tenant == "acme"`)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	if f.Match(nil, nil) {
+		t.Error("Match with nil inputs should be false")
+	}
+	if f.String() != `tenant == "acme"` {
+		t.Errorf("String() = %s, want %s", f.String(), `tenant == "acme"`)
+	}
+}
+
+func TestFieldsOf(t *testing.T) {
+	type message struct {
+		Tenant string `json:"tenant"`
+		Count  int    `json:"count"`
+	}
+
+	fields := FieldsOf(message{Tenant: "acme", Count: 3})
+	if fields["tenant"] != "acme" {
+		t.Errorf("fields[tenant] = %v, want acme", fields["tenant"])
+	}
+	if fields["count"] != float64(3) {
+		t.Errorf("fields[count] = %v, want 3", fields["count"])
+	}
+
+	if FieldsOf("plain string") != nil {
+		t.Error("FieldsOf for non object value should be nil")
+	}
+}
@@ -11,10 +11,12 @@ package mocks
 
 import (
 	context "context"
+	json "encoding/json"
 	reflect "reflect"
 	time "time"
 
 	gocb "github.com/couchbase/gocb/v2"
+	repository "github.com/halilbulentorhon/cb-pubsub/repository"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -56,6 +58,52 @@ func (mr *MockRepositoryMockRecorder) ArrayAppend(ctx, key, path, values any) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ArrayAppend", reflect.TypeOf((*MockRepository)(nil).ArrayAppend), ctx, key, path, values)
 }
 
+// ArrayCount mocks base method.
+func (m *MockRepository) ArrayCount(ctx context.Context, key, path string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ArrayCount", ctx, key, path)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ArrayCount indicates an expected call of ArrayCount.
+func (mr *MockRepositoryMockRecorder) ArrayCount(ctx, key, path any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ArrayCount", reflect.TypeOf((*MockRepository)(nil).ArrayCount), ctx, key, path)
+}
+
+// ArrayGetRange mocks base method.
+func (m *MockRepository) ArrayGetRange(ctx context.Context, key, path, seqPath string, fromIndex, toIndex int) ([]json.RawMessage, repository.ArrayState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ArrayGetRange", ctx, key, path, seqPath, fromIndex, toIndex)
+	ret0, _ := ret[0].([]json.RawMessage)
+	ret1, _ := ret[1].(repository.ArrayState)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ArrayGetRange indicates an expected call of ArrayGetRange.
+func (mr *MockRepositoryMockRecorder) ArrayGetRange(ctx, key, path, seqPath, fromIndex, toIndex any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ArrayGetRange", reflect.TypeOf((*MockRepository)(nil).ArrayGetRange), ctx, key, path, seqPath, fromIndex, toIndex)
+}
+
+// ArrayHeadState mocks base method.
+func (m *MockRepository) ArrayHeadState(ctx context.Context, key, path, seqPath string) (repository.ArrayState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ArrayHeadState", ctx, key, path, seqPath)
+	ret0, _ := ret[0].(repository.ArrayState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ArrayHeadState indicates an expected call of ArrayHeadState.
+func (mr *MockRepositoryMockRecorder) ArrayHeadState(ctx, key, path, seqPath any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ArrayHeadState", reflect.TypeOf((*MockRepository)(nil).ArrayHeadState), ctx, key, path, seqPath)
+}
+
 // ArrayRemoveFromIndex mocks base method.
 func (m *MockRepository) ArrayRemoveFromIndex(ctx context.Context, key, path string, fromIndex, toIndex int) error {
 	m.ctrl.T.Helper()
@@ -70,6 +118,20 @@ func (mr *MockRepositoryMockRecorder) ArrayRemoveFromIndex(ctx, key, path, fromI
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ArrayRemoveFromIndex", reflect.TypeOf((*MockRepository)(nil).ArrayRemoveFromIndex), ctx, key, path, fromIndex, toIndex)
 }
 
+// ArrayRemoveHead mocks base method.
+func (m *MockRepository) ArrayRemoveHead(ctx context.Context, key, path, seqPath string, count int, cas gocb.Cas) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ArrayRemoveHead", ctx, key, path, seqPath, count, cas)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ArrayRemoveHead indicates an expected call of ArrayRemoveHead.
+func (mr *MockRepositoryMockRecorder) ArrayRemoveHead(ctx, key, path, seqPath, count, cas any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ArrayRemoveHead", reflect.TypeOf((*MockRepository)(nil).ArrayRemoveHead), ctx, key, path, seqPath, count, cas)
+}
+
 // Close mocks base method.
 func (m *MockRepository) Close() error {
 	m.ctrl.T.Helper()
@@ -98,6 +160,35 @@ func (mr *MockRepositoryMockRecorder) Delete(ctx, key any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockRepository)(nil).Delete), ctx, key)
 }
 
+// DeleteWithCas mocks base method.
+func (m *MockRepository) DeleteWithCas(ctx context.Context, key string, cas gocb.Cas) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWithCas", ctx, key, cas)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWithCas indicates an expected call of DeleteWithCas.
+func (mr *MockRepositoryMockRecorder) DeleteWithCas(ctx, key, cas any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWithCas", reflect.TypeOf((*MockRepository)(nil).DeleteWithCas), ctx, key, cas)
+}
+
+// Exists mocks base method.
+func (m *MockRepository) Exists(ctx context.Context, key string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Exists", ctx, key)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Exists indicates an expected call of Exists.
+func (mr *MockRepositoryMockRecorder) Exists(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exists", reflect.TypeOf((*MockRepository)(nil).Exists), ctx, key)
+}
+
 // Get mocks base method.
 func (m *MockRepository) Get(ctx context.Context, key string, result any) (gocb.Cas, error) {
 	m.ctrl.T.Helper()
@@ -128,6 +219,21 @@ func (mr *MockRepositoryMockRecorder) GetAndTouch(ctx, key, result, ttl any) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAndTouch", reflect.TypeOf((*MockRepository)(nil).GetAndTouch), ctx, key, result, ttl)
 }
 
+// Insert mocks base method.
+func (m *MockRepository) Insert(ctx context.Context, key string, document any, ttl time.Duration) (gocb.Cas, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Insert", ctx, key, document, ttl)
+	ret0, _ := ret[0].(gocb.Cas)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Insert indicates an expected call of Insert.
+func (mr *MockRepositoryMockRecorder) Insert(ctx, key, document, ttl any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockRepository)(nil).Insert), ctx, key, document, ttl)
+}
+
 // RemoveMultiplePaths mocks base method.
 func (m *MockRepository) RemoveMultiplePaths(ctx context.Context, key string, paths []string) error {
 	m.ctrl.T.Helper()
@@ -156,6 +262,20 @@ func (mr *MockRepositoryMockRecorder) ReplaceWithCas(ctx, key, document, ttl, ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceWithCas", reflect.TypeOf((*MockRepository)(nil).ReplaceWithCas), ctx, key, document, ttl, cas)
 }
 
+// Touch mocks base method.
+func (m *MockRepository) Touch(ctx context.Context, key string, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Touch", ctx, key, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Touch indicates an expected call of Touch.
+func (mr *MockRepositoryMockRecorder) Touch(ctx, key, ttl any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Touch", reflect.TypeOf((*MockRepository)(nil).Touch), ctx, key, ttl)
+}
+
 // Upsert mocks base method.
 func (m *MockRepository) Upsert(ctx context.Context, key string, document any, ttl time.Duration) error {
 	m.ctrl.T.Helper()
@@ -1,3 +1,47 @@
 package model
 
-type AssignmentDoc map[string]map[string]int64
+import (
+	"encoding/json"
+	"time"
+)
+
+type AssignmentDoc map[string]map[string]AssignmentEntry
+
+type AssignmentEntry struct {
+	MemberMetadata
+	Filter    string `json:"filter,omitempty"`
+	Paused    bool   `json:"paused,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type MemberMetadata struct {
+	Hostname  string            `json:"hostname,omitempty"`
+	Pod       string            `json:"pod,omitempty"`
+	Version   string            `json:"version,omitempty"`
+	StartedAt int64             `json:"startedAt,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type assignmentEntryAlias AssignmentEntry
+
+func (e *AssignmentEntry) UnmarshalJSON(data []byte) error {
+	var timestamp int64
+	if err := json.Unmarshal(data, &timestamp); err == nil {
+		*e = AssignmentEntry{Timestamp: timestamp}
+		return nil
+	}
+
+	var entry assignmentEntryAlias
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return err
+	}
+	*e = AssignmentEntry(entry)
+	return nil
+}
+
+func CreateAssignmentEntry(filter string) AssignmentEntry {
+	return AssignmentEntry{
+		Filter:    filter,
+		Timestamp: time.Now().Unix(),
+	}
+}
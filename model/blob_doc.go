@@ -0,0 +1,11 @@
+package model
+
+type BlobDoc struct {
+	Data []byte `json:"data"`
+}
+
+type BlobRef struct {
+	Id     string `json:"id"`
+	Chunks int    `json:"chunks"`
+	Size   int    `json:"size"`
+}
@@ -0,0 +1,6 @@
+package model
+
+type LeaseDoc struct {
+	Holder    string `json:"holder"`
+	RenewedAt int64  `json:"renewedAt"`
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/halilbulentorhon/cb-pubsub/codec"
+)
+
+type Message struct {
+	Headers        map[string]string `json:"headers,omitempty"`
+	Codec          string            `json:"codec"`
+	Encoding       string            `json:"encoding,omitempty"`
+	KeyId          string            `json:"keyId,omitempty"`
+	SignatureKeyId string            `json:"signatureKeyId,omitempty"`
+	Signature      []byte            `json:"signature,omitempty"`
+	Blob           *BlobRef          `json:"blob,omitempty"`
+	Payload        []byte            `json:"payload"`
+}
+
+type messageFields Message
+
+type messageJSON struct {
+	*messageFields
+	Payload json.RawMessage `json:"payload"`
+}
+
+func (m Message) MarshalJSON() ([]byte, error) {
+	if !m.hasRawPayload() || len(m.Payload) == 0 {
+		return json.Marshal((*messageFields)(&m))
+	}
+	return json.Marshal(messageJSON{messageFields: (*messageFields)(&m), Payload: m.Payload})
+}
+
+func (m *Message) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		*m = Message{Payload: append([]byte(nil), trimmed...)}
+		return nil
+	}
+
+	wire := messageJSON{messageFields: &messageFields{}}
+	if err := json.Unmarshal(trimmed, &wire); err != nil {
+		return err
+	}
+	if wire.Codec == "" {
+		*m = Message{Payload: append([]byte(nil), trimmed...)}
+		return nil
+	}
+
+	*m = Message(*wire.messageFields)
+	if len(wire.Payload) == 0 || bytes.Equal(wire.Payload, []byte("null")) {
+		return nil
+	}
+	if m.hasRawPayload() {
+		m.Payload = append([]byte(nil), wire.Payload...)
+		return nil
+	}
+	return json.Unmarshal(wire.Payload, &m.Payload)
+}
+
+func (m Message) hasRawPayload() bool {
+	return m.Codec == codec.JSONName && m.Encoding == "" && m.KeyId == "" && m.Blob == nil
+}
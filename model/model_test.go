@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 )
@@ -108,12 +109,12 @@ func TestPubSubDoc_FieldTypes(t *testing.T) {
 
 func TestAssignmentDoc_Type(t *testing.T) {
 	doc := make(AssignmentDoc)
-	doc["channel1"] = make(map[string]int64)
-	doc["channel1"]["instance1"] = 1234567890
-	doc["channel1"]["instance2"] = 1234567891
+	doc["channel1"] = make(map[string]AssignmentEntry)
+	doc["channel1"]["instance1"] = AssignmentEntry{Timestamp: 1234567890}
+	doc["channel1"]["instance2"] = AssignmentEntry{Timestamp: 1234567891}
 
-	doc["channel2"] = make(map[string]int64)
-	doc["channel2"]["instance3"] = 1234567892
+	doc["channel2"] = make(map[string]AssignmentEntry)
+	doc["channel2"]["instance3"] = AssignmentEntry{Timestamp: 1234567892}
 
 	if len(doc) != 2 {
 		t.Errorf("AssignmentDoc length = %d, want 2", len(doc))
@@ -126,8 +127,8 @@ func TestAssignmentDoc_Type(t *testing.T) {
 	if len(channel1) != 2 {
 		t.Errorf("channel1 length = %d, want 2", len(channel1))
 	}
-	if channel1["instance1"] != 1234567890 {
-		t.Errorf("channel1[instance1] = %d, want 1234567890", channel1["instance1"])
+	if channel1["instance1"].Timestamp != 1234567890 {
+		t.Errorf("channel1[instance1] = %d, want 1234567890", channel1["instance1"].Timestamp)
 	}
 
 	channel2, exists := doc["channel2"]
@@ -137,7 +138,156 @@ func TestAssignmentDoc_Type(t *testing.T) {
 	if len(channel2) != 1 {
 		t.Errorf("channel2 length = %d, want 1", len(channel2))
 	}
-	if channel2["instance3"] != 1234567892 {
-		t.Errorf("channel2[instance3] = %d, want 1234567892", channel2["instance3"])
+	if channel2["instance3"].Timestamp != 1234567892 {
+		t.Errorf("channel2[instance3] = %d, want 1234567892", channel2["instance3"].Timestamp)
+	}
+}
+
+func TestAssignmentDoc_Unmarshal(t *testing.T) {
+	data := []byte(`{"channel1":{"legacy":1234567890,"filtered":{"timestamp":1234567891,"filter":"tenant == \"acme\"","paused":true}}}`)
+
+	var doc AssignmentDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+
+	legacy := doc["channel1"]["legacy"]
+	if legacy.Timestamp != 1234567890 || legacy.Filter != "" {
+		t.Errorf("legacy entry = %+v, want timestamp 1234567890 without filter", legacy)
+	}
+
+	filtered := doc["channel1"]["filtered"]
+	if filtered.Timestamp != 1234567891 {
+		t.Errorf("filtered Timestamp = %d, want 1234567891", filtered.Timestamp)
+	}
+	if filtered.Filter != `tenant == "acme"` {
+		t.Errorf("filtered Filter = %s, want %s", filtered.Filter, `tenant == "acme"`)
+	}
+	if !filtered.Paused {
+		t.Error("filtered Paused = false, want true")
+	}
+	if legacy.Paused {
+		t.Error("legacy Paused = true, want false")
+	}
+}
+
+func TestAssignmentEntry_MetadataRoundTrip(t *testing.T) {
+	entry := AssignmentEntry{
+		MemberMetadata: MemberMetadata{
+			Hostname:  "host-1",
+			Pod:       "orders-7d9f",
+			Version:   "1.4.0",
+			StartedAt: 1234567000,
+			Labels:    map[string]string{"zone": "eu-1"},
+		},
+		Timestamp: 1234567890,
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+	want := `{"hostname":"host-1","pod":"orders-7d9f","version":"1.4.0","startedAt":1234567000,"labels":{"zone":"eu-1"},"timestamp":1234567890}`
+	if string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+
+	var decoded AssignmentEntry
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+	if decoded.Hostname != "host-1" || decoded.Pod != "orders-7d9f" || decoded.Version != "1.4.0" || decoded.StartedAt != 1234567000 {
+		t.Errorf("decoded metadata = %+v, want original metadata", decoded.MemberMetadata)
+	}
+	if decoded.Labels["zone"] != "eu-1" {
+		t.Errorf("decoded Labels = %v, want zone=eu-1", decoded.Labels)
+	}
+}
+
+func TestCreateAssignmentEntry(t *testing.T) {
+	before := time.Now().Unix()
+	entry := CreateAssignmentEntry(`tenant == "acme"`)
+	after := time.Now().Unix()
+
+	if entry.Timestamp < before || entry.Timestamp > after {
+		t.Errorf("Timestamp = %d, want between %d and %d", entry.Timestamp, before, after)
+	}
+	if entry.Filter != `tenant == "acme"` {
+		t.Errorf("Filter = %s, want %s", entry.Filter, `tenant == "acme"`)
+	}
+}
+
+func TestMessage_JSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		message Message
+		want    string
+	}{
+		{
+			name:    "json payload stored as json",
+			message: Message{Codec: "json", Payload: []byte(`{"id":1}`)},
+			want:    `{"codec":"json","payload":{"id":1}}`,
+		},
+		{
+			name:    "compressed json payload stored as base64",
+			message: Message{Codec: "json", Encoding: "gzip", Payload: []byte("abc")},
+			want:    `{"codec":"json","encoding":"gzip","payload":"YWJj"}`,
+		},
+		{
+			name:    "binary codec payload stored as base64",
+			message: Message{Codec: "gob", Payload: []byte("abc")},
+			want:    `{"codec":"gob","payload":"YWJj"}`,
+		},
+		{
+			name:    "offloaded payload",
+			message: Message{Codec: "json", Blob: &BlobRef{Id: "b1", Chunks: 1, Size: 3}},
+			want:    `{"codec":"json","blob":{"id":"b1","chunks":1,"size":3},"payload":null}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.message)
+			if err != nil {
+				t.Fatalf("Marshal returned error: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Marshal = %s, want %s", data, tt.want)
+			}
+
+			var decoded Message
+			if err = json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal returned error: %v", err)
+			}
+			if string(decoded.Payload) != string(tt.message.Payload) || decoded.Codec != tt.message.Codec || decoded.Encoding != tt.message.Encoding {
+				t.Errorf("decoded = %+v, want %+v", decoded, tt.message)
+			}
+		})
+	}
+}
+
+func TestMessage_UnmarshalLegacy(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "string", data: `"msg1"`},
+		{name: "number", data: `42`},
+		{name: "object without codec", data: `{"id":1,"payload":"x"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decoded Message
+			if err := json.Unmarshal([]byte(tt.data), &decoded); err != nil {
+				t.Fatalf("Unmarshal returned error: %v", err)
+			}
+			if decoded.Codec != "" {
+				t.Errorf("Codec = %q, want empty", decoded.Codec)
+			}
+			if string(decoded.Payload) != tt.data {
+				t.Errorf("Payload = %s, want %s", decoded.Payload, tt.data)
+			}
+		})
 	}
 }
@@ -5,6 +5,7 @@ import "time"
 type PubSubDoc[T any] struct {
 	Messages     []T   `json:"messages"`
 	CreationDate int64 `json:"creationDate"`
+	HeadSeq      int64 `json:"headSeq,omitempty"`
 }
 
 func CreatePubSubDoc[T any]() PubSubDoc[T] {
@@ -0,0 +1,331 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/couchbase/gocbcore/v10"
+	"github.com/couchbase/gocbcore/v10/memd"
+	"github.com/google/uuid"
+	"github.com/halilbulentorhon/cb-pubsub/config"
+	util "github.com/halilbulentorhon/cb-pubsub/pkg"
+)
+
+const defaultCollection = "_default"
+
+type DCP struct {
+	agent        *gocbcore.DCPAgent
+	watchers     watchers
+	logger       util.Logger
+	filter       *gocbcore.OpenStreamFilterOptions
+	mu           sync.Mutex
+	hashes       map[string]uint64
+	seqNos       map[uint16]gocbcore.SeqNo
+	vbUUIDs      map[uint16]gocbcore.VbUUID
+	snapshot     map[uint16][2]gocbcore.SeqNo
+	collectionID uint32
+	closed       bool
+}
+
+func NewDCP(cfg config.CouchbaseConfig) (*DCP, error) {
+	connectTimeout := time.Duration(cfg.ConnectTimeoutSec) * time.Second
+	if connectTimeout <= 0 {
+		connectTimeout = 10 * time.Second
+	}
+
+	agentConfig := gocbcore.DCPAgentConfig{}
+	if err := agentConfig.FromConnStr(cfg.Host); err != nil {
+		return nil, fmt.Errorf("invalid couchbase host %q: %w", cfg.Host, err)
+	}
+	agentConfig.UserAgent = "cb-pubsub"
+	agentConfig.BucketName = cfg.BucketName
+	agentConfig.SecurityConfig.Auth = gocbcore.PasswordAuthProvider{
+		Username: cfg.Username,
+		Password: cfg.Password,
+	}
+
+	n := &DCP{
+		logger:   util.NewLogger("cb-pubsub").With("component", "dcp-notifier"),
+		hashes:   make(map[string]uint64),
+		seqNos:   make(map[uint16]gocbcore.SeqNo),
+		vbUUIDs:  make(map[uint16]gocbcore.VbUUID),
+		snapshot: make(map[uint16][2]gocbcore.SeqNo),
+	}
+
+	if !isDefaultCollection(cfg) {
+		collectionID, err := resolveCollectionID(cfg, connectTimeout)
+		if err != nil {
+			return nil, err
+		}
+		agentConfig.IoConfig.UseCollections = true
+		n.collectionID = collectionID
+		n.filter = &gocbcore.OpenStreamFilterOptions{CollectionIDs: []uint32{collectionID}}
+	}
+
+	agent, err := gocbcore.CreateDcpAgent(&agentConfig, "cb-pubsub-"+uuid.NewString(), memd.DcpOpenFlagProducer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dcp agent: %w", err)
+	}
+	n.agent = agent
+
+	if err = n.start(connectTimeout); err != nil {
+		_ = agent.Close()
+		return nil, err
+	}
+	return n, nil
+}
+
+func isDefaultCollection(cfg config.CouchbaseConfig) bool {
+	return (cfg.ScopeName == "" || cfg.ScopeName == defaultCollection) &&
+		(cfg.CollectionName == "" || cfg.CollectionName == defaultCollection)
+}
+
+func resolveCollectionID(cfg config.CouchbaseConfig, timeout time.Duration) (uint32, error) {
+	agentConfig := gocbcore.AgentConfig{}
+	if err := agentConfig.FromConnStr(cfg.Host); err != nil {
+		return 0, fmt.Errorf("invalid couchbase host %q: %w", cfg.Host, err)
+	}
+	agentConfig.UserAgent = "cb-pubsub"
+	agentConfig.BucketName = cfg.BucketName
+	agentConfig.IoConfig.UseCollections = true
+	agentConfig.SecurityConfig.Auth = gocbcore.PasswordAuthProvider{
+		Username: cfg.Username,
+		Password: cfg.Password,
+	}
+
+	agent, err := gocbcore.CreateAgent(&agentConfig)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create agent: %w", err)
+	}
+	defer func() { _ = agent.Close() }()
+
+	var collectionID uint32
+	resultCh := make(chan error, 1)
+	_, err = agent.GetCollectionID(cfg.ScopeName, cfg.CollectionName, gocbcore.GetCollectionIDOptions{
+		RetryStrategy: gocbcore.NewBestEffortRetryStrategy(nil),
+		Deadline:      time.Now().Add(timeout),
+	}, func(result *gocbcore.GetCollectionIDResult, err error) {
+		if err == nil {
+			collectionID = result.CollectionID
+		}
+		resultCh <- err
+	})
+	if err == nil {
+		err = <-resultCh
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve collection %s.%s: %w", cfg.ScopeName, cfg.CollectionName, err)
+	}
+	return collectionID, nil
+}
+
+func (n *DCP) Watch(key string) (<-chan struct{}, func()) {
+	return n.watchers.watch(key)
+}
+
+func (n *DCP) Close() error {
+	n.mu.Lock()
+	n.closed = true
+	n.mu.Unlock()
+
+	n.watchers.close()
+	return n.agent.Close()
+}
+
+func (n *DCP) start(timeout time.Duration) error {
+	readyCh := make(chan error, 1)
+	_, err := n.agent.WaitUntilReady(time.Now().Add(timeout), gocbcore.WaitUntilReadyOptions{}, func(_ *gocbcore.WaitUntilReadyResult, err error) {
+		readyCh <- err
+	})
+	if err != nil {
+		return fmt.Errorf("dcp agent not ready: %w", err)
+	}
+	if err = <-readyCh; err != nil {
+		return fmt.Errorf("dcp agent not ready: %w", err)
+	}
+
+	seqNos, err := n.currentSeqNos()
+	if err != nil {
+		return err
+	}
+
+	for vbID, seqNo := range seqNos {
+		vbUUID, err := n.vbUUID(vbID)
+		if err != nil {
+			return err
+		}
+		n.mu.Lock()
+		n.seqNos[vbID] = seqNo
+		n.vbUUIDs[vbID] = vbUUID
+		n.mu.Unlock()
+
+		if err = n.openStream(vbID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *DCP) currentSeqNos() (map[uint16]gocbcore.SeqNo, error) {
+	snapshot, err := n.agent.ConfigSnapshot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dcp config snapshot: %w", err)
+	}
+	servers, err := snapshot.NumServers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server count: %w", err)
+	}
+
+	seqNos := make(map[uint16]gocbcore.SeqNo)
+	for i := 0; i < servers; i++ {
+		resultCh := make(chan error, 1)
+		_, err = n.agent.GetVbucketSeqnos(i, memd.VbucketStateActive, gocbcore.GetVbucketSeqnoOptions{}, func(entries []gocbcore.VbSeqNoEntry, err error) {
+			for _, entry := range entries {
+				seqNos[entry.VbID] = entry.SeqNo
+			}
+			resultCh <- err
+		})
+		if err == nil {
+			err = <-resultCh
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get vbucket seqnos from server %d: %w", i, err)
+		}
+	}
+	return seqNos, nil
+}
+
+func (n *DCP) vbUUID(vbID uint16) (gocbcore.VbUUID, error) {
+	var vbUUID gocbcore.VbUUID
+	resultCh := make(chan error, 1)
+	_, err := n.agent.GetFailoverLog(vbID, func(entries []gocbcore.FailoverEntry, err error) {
+		if err == nil && len(entries) > 0 {
+			vbUUID = entries[0].VbUUID
+		}
+		resultCh <- err
+	})
+	if err == nil {
+		err = <-resultCh
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get failover log for vbucket %d: %w", vbID, err)
+	}
+	return vbUUID, nil
+}
+
+func (n *DCP) openStream(vbID uint16) error {
+	n.mu.Lock()
+	seqNo := n.seqNos[vbID]
+	vbUUID := n.vbUUIDs[vbID]
+	snapStart, snapEnd := seqNo, seqNo
+	if snapshot, found := n.snapshot[vbID]; found && seqNo < snapshot[1] {
+		snapStart, snapEnd = snapshot[0], snapshot[1]
+	}
+	n.mu.Unlock()
+
+	resultCh := make(chan error, 1)
+	_, err := n.agent.OpenStream(vbID, 0, vbUUID, seqNo, math.MaxUint64, snapStart, snapEnd, &dcpObserver{notifier: n}, gocbcore.OpenStreamOptions{FilterOptions: n.filter}, func(_ []gocbcore.FailoverEntry, err error) {
+		resultCh <- err
+	})
+	if err == nil {
+		err = <-resultCh
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open dcp stream for vbucket %d: %w", vbID, err)
+	}
+	return nil
+}
+
+func (n *DCP) changed(vbID uint16, seqNo uint64, collectionID uint32, key string, value []byte, deleted bool) {
+	n.mu.Lock()
+	n.seqNos[vbID] = gocbcore.SeqNo(seqNo)
+	n.mu.Unlock()
+
+	if collectionID != n.collectionID || !n.watchers.watched(key) {
+		return
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write(value)
+	sum := h.Sum64()
+
+	n.mu.Lock()
+	previous, found := n.hashes[key]
+	if deleted {
+		delete(n.hashes, key)
+	} else {
+		n.hashes[key] = sum
+	}
+	n.mu.Unlock()
+
+	if !deleted && found && previous == sum {
+		return
+	}
+	n.watchers.notify(key)
+}
+
+func (n *DCP) ended(vbID uint16, err error) {
+	n.mu.Lock()
+	closed := n.closed
+	n.mu.Unlock()
+	if closed || err == nil || errors.Is(err, gocbcore.ErrDCPStreamClosed) {
+		return
+	}
+
+	n.logger.Warn("dcp stream ended, reopening", "vbucket", vbID, "error", err)
+	go func() {
+		if err := n.openStream(vbID); err != nil {
+			n.logger.Error("failed to reopen dcp stream, falling back to polling", "vbucket", vbID, "error", err)
+		}
+	}()
+}
+
+type dcpObserver struct {
+	notifier *DCP
+}
+
+func (o *dcpObserver) SnapshotMarker(m gocbcore.DcpSnapshotMarker) {
+	o.notifier.mu.Lock()
+	o.notifier.snapshot[m.VbID] = [2]gocbcore.SeqNo{gocbcore.SeqNo(m.StartSeqNo), gocbcore.SeqNo(m.EndSeqNo)}
+	o.notifier.mu.Unlock()
+}
+
+func (o *dcpObserver) Mutation(m gocbcore.DcpMutation) {
+	o.notifier.changed(m.VbID, m.SeqNo, m.CollectionID, string(m.Key), m.Value, false)
+}
+
+func (o *dcpObserver) Deletion(d gocbcore.DcpDeletion) {
+	o.notifier.changed(d.VbID, d.SeqNo, d.CollectionID, string(d.Key), nil, true)
+}
+
+func (o *dcpObserver) Expiration(e gocbcore.DcpExpiration) {
+	o.notifier.changed(e.VbID, e.SeqNo, e.CollectionID, string(e.Key), nil, true)
+}
+
+func (o *dcpObserver) End(end gocbcore.DcpStreamEnd, err error) {
+	o.notifier.ended(end.VbID, err)
+}
+
+func (o *dcpObserver) CreateCollection(gocbcore.DcpCollectionCreation) {}
+
+func (o *dcpObserver) DeleteCollection(gocbcore.DcpCollectionDeletion) {}
+
+func (o *dcpObserver) FlushCollection(gocbcore.DcpCollectionFlush) {}
+
+func (o *dcpObserver) CreateScope(gocbcore.DcpScopeCreation) {}
+
+func (o *dcpObserver) DeleteScope(gocbcore.DcpScopeDeletion) {}
+
+func (o *dcpObserver) ModifyCollection(gocbcore.DcpCollectionModification) {}
+
+func (o *dcpObserver) OSOSnapshot(gocbcore.DcpOSOSnapshot) {}
+
+func (o *dcpObserver) SeqNoAdvanced(a gocbcore.DcpSeqNoAdvanced) {
+	o.notifier.mu.Lock()
+	o.notifier.seqNos[a.VbID] = gocbcore.SeqNo(a.SeqNo)
+	o.notifier.mu.Unlock()
+}
@@ -0,0 +1,144 @@
+package notifier
+
+import (
+	"testing"
+
+	"github.com/couchbase/gocbcore/v10"
+	"github.com/halilbulentorhon/cb-pubsub/config"
+)
+
+func TestDCP_Changed(t *testing.T) {
+	n := &DCP{
+		hashes:   make(map[string]uint64),
+		seqNos:   make(map[uint16]gocbcore.SeqNo),
+		vbUUIDs:  make(map[uint16]gocbcore.VbUUID),
+		snapshot: make(map[uint16][2]gocbcore.SeqNo),
+	}
+	changes, stop := n.Watch("doc-1")
+	defer stop()
+
+	tests := []struct {
+		name     string
+		key      string
+		value    []byte
+		deleted  bool
+		expected bool
+	}{
+		{name: "first mutation", key: "doc-1", value: []byte(`{"messages":[]}`), expected: true},
+		{name: "touch without content change", key: "doc-1", value: []byte(`{"messages":[]}`), expected: false},
+		{name: "content change", key: "doc-1", value: []byte(`{"messages":[1]}`), expected: true},
+		{name: "unwatched key", key: "doc-2", value: []byte(`{}`), expected: false},
+		{name: "deletion", key: "doc-1", deleted: true, expected: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n.changed(1, uint64(i+1), 0, tt.key, tt.value, tt.deleted)
+
+			notified := false
+			select {
+			case <-changes:
+				notified = true
+			default:
+			}
+			if notified != tt.expected {
+				t.Errorf("notified = %v, want %v", notified, tt.expected)
+			}
+		})
+	}
+
+	if n.seqNos[1] != gocbcore.SeqNo(len(tests)) {
+		t.Errorf("seqNo = %d, want %d", n.seqNos[1], len(tests))
+	}
+}
+
+func TestDCP_Observer_FiltersCollection(t *testing.T) {
+	n := &DCP{
+		hashes:       make(map[string]uint64),
+		seqNos:       make(map[uint16]gocbcore.SeqNo),
+		vbUUIDs:      make(map[uint16]gocbcore.VbUUID),
+		snapshot:     make(map[uint16][2]gocbcore.SeqNo),
+		collectionID: 8,
+	}
+	observer := &dcpObserver{notifier: n}
+	changes, stop := n.Watch("doc-1")
+	defer stop()
+
+	tests := []struct {
+		name     string
+		event    func()
+		expected bool
+	}{
+		{
+			name: "mutation in other collection",
+			event: func() {
+				observer.Mutation(gocbcore.DcpMutation{VbID: 1, SeqNo: 1, CollectionID: 0, Key: []byte("doc-1"), Value: []byte(`{}`)})
+			},
+			expected: false,
+		},
+		{
+			name: "mutation in configured collection",
+			event: func() {
+				observer.Mutation(gocbcore.DcpMutation{VbID: 1, SeqNo: 2, CollectionID: 8, Key: []byte("doc-1"), Value: []byte(`{}`)})
+			},
+			expected: true,
+		},
+		{
+			name: "deletion in other collection",
+			event: func() {
+				observer.Deletion(gocbcore.DcpDeletion{VbID: 1, SeqNo: 3, CollectionID: 9, Key: []byte("doc-1")})
+			},
+			expected: false,
+		},
+		{
+			name: "expiration in configured collection",
+			event: func() {
+				observer.Expiration(gocbcore.DcpExpiration{VbID: 1, SeqNo: 4, CollectionID: 8, Key: []byte("doc-1")})
+			},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.event()
+
+			notified := false
+			select {
+			case <-changes:
+				notified = true
+			default:
+			}
+			if notified != tt.expected {
+				t.Errorf("notified = %v, want %v", notified, tt.expected)
+			}
+		})
+	}
+
+	if n.seqNos[1] != gocbcore.SeqNo(len(tests)) {
+		t.Errorf("seqNo = %d, want %d", n.seqNos[1], len(tests))
+	}
+}
+
+func TestIsDefaultCollection(t *testing.T) {
+	tests := []struct {
+		name       string
+		scope      string
+		collection string
+		expected   bool
+	}{
+		{name: "empty", expected: true},
+		{name: "explicit default", scope: "_default", collection: "_default", expected: true},
+		{name: "custom collection", scope: "_default", collection: "events", expected: false},
+		{name: "custom scope", scope: "app", collection: "_default", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.CouchbaseConfig{ScopeName: tt.scope, CollectionName: tt.collection}
+			if got := isDefaultCollection(cfg); got != tt.expected {
+				t.Errorf("isDefaultCollection() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package notifier
+
+type InProcess struct {
+	watchers watchers
+}
+
+func NewInProcess() *InProcess {
+	return &InProcess{}
+}
+
+func (n *InProcess) Watch(key string) (<-chan struct{}, func()) {
+	return n.watchers.watch(key)
+}
+
+func (n *InProcess) Notify(key string) {
+	n.watchers.notify(key)
+}
+
+func (n *InProcess) Close() error {
+	n.watchers.close()
+	return nil
+}
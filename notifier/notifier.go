@@ -0,0 +1,86 @@
+package notifier
+
+import "sync"
+
+type ChangeNotifier interface {
+	Watch(key string) (<-chan struct{}, func())
+	Close() error
+}
+
+type Publisher interface {
+	Notify(key string)
+}
+
+type watchers struct {
+	mu       sync.Mutex
+	channels map[string]map[chan struct{}]struct{}
+	closed   bool
+}
+
+func (w *watchers) watch(key string) (<-chan struct{}, func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	if w.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if w.channels == nil {
+		w.channels = make(map[string]map[chan struct{}]struct{})
+	}
+	if w.channels[key] == nil {
+		w.channels[key] = make(map[chan struct{}]struct{})
+	}
+	w.channels[key][ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if _, found := w.channels[key][ch]; !found {
+				return
+			}
+			delete(w.channels[key], ch)
+			if len(w.channels[key]) == 0 {
+				delete(w.channels, key)
+			}
+			close(ch)
+		})
+	}
+}
+
+func (w *watchers) watched(key string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.channels[key]) > 0
+}
+
+func (w *watchers) notify(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ch := range w.channels[key] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *watchers) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	w.closed = true
+	for _, channels := range w.channels {
+		for ch := range channels {
+			close(ch)
+		}
+	}
+	w.channels = nil
+}
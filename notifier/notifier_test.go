@@ -0,0 +1,66 @@
+package notifier
+
+import (
+	"testing"
+)
+
+func TestInProcess_Notify(t *testing.T) {
+	n := NewInProcess()
+	defer n.Close()
+
+	changes, stop := n.Watch("doc-1")
+	defer stop()
+	other, stopOther := n.Watch("doc-2")
+	defer stopOther()
+
+	n.Notify("doc-1")
+	n.Notify("doc-1")
+
+	select {
+	case <-changes:
+	default:
+		t.Fatal("watcher of doc-1 should be notified")
+	}
+	select {
+	case <-changes:
+		t.Error("repeated notifications should be coalesced")
+	default:
+	}
+	select {
+	case <-other:
+		t.Error("watcher of doc-2 should not be notified")
+	default:
+	}
+}
+
+func TestInProcess_Stop(t *testing.T) {
+	n := NewInProcess()
+	defer n.Close()
+
+	changes, stop := n.Watch("doc-1")
+	stop()
+	stop()
+
+	if _, ok := <-changes; ok {
+		t.Error("channel should be closed after stop")
+	}
+	n.Notify("doc-1")
+}
+
+func TestInProcess_Close(t *testing.T) {
+	n := NewInProcess()
+	changes, stop := n.Watch("doc-1")
+
+	if err := n.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if _, ok := <-changes; ok {
+		t.Error("channel should be closed after Close")
+	}
+	stop()
+
+	late, _ := n.Watch("doc-1")
+	if _, ok := <-late; ok {
+		t.Error("Watch after Close should return a closed channel")
+	}
+}
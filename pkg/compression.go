@@ -0,0 +1,64 @@
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/halilbulentorhon/cb-pubsub/constant"
+)
+
+func IsSupportedCompression(algorithm string) bool {
+	switch algorithm {
+	case constant.CompressionGzip, constant.CompressionSnappy:
+		return true
+	default:
+		return false
+	}
+}
+
+func Compress(algorithm string, data []byte) ([]byte, error) {
+	switch algorithm {
+	case constant.CompressionGzip:
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to gzip payload: %w", err)
+		}
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip payload: %w", err)
+		}
+		return buf.Bytes(), nil
+	case constant.CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", algorithm)
+	}
+}
+
+func Decompress(algorithm string, data []byte) ([]byte, error) {
+	switch algorithm {
+	case constant.CompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to gunzip payload: %w", err)
+		}
+		defer reader.Close()
+
+		decompressed, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to gunzip payload: %w", err)
+		}
+		return decompressed, nil
+	case constant.CompressionSnappy:
+		decompressed, err := snappy.Decode(nil, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode snappy payload: %w", err)
+		}
+		return decompressed, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", algorithm)
+	}
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/halilbulentorhon/cb-pubsub/constant"
+)
+
+func TestCompress_RoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte(`{"tenant":"acme","items":[1,2,3]}`), 100)
+
+	for _, algorithm := range []string{constant.CompressionGzip, constant.CompressionSnappy} {
+		t.Run(algorithm, func(t *testing.T) {
+			if !IsSupportedCompression(algorithm) {
+				t.Fatalf("IsSupportedCompression(%s) = false, want true", algorithm)
+			}
+
+			compressed, err := Compress(algorithm, payload)
+			if err != nil {
+				t.Fatalf("Compress returned error: %v", err)
+			}
+			if len(compressed) >= len(payload) {
+				t.Errorf("compressed length = %d, want less than %d", len(compressed), len(payload))
+			}
+
+			decompressed, err := Decompress(algorithm, compressed)
+			if err != nil {
+				t.Fatalf("Decompress returned error: %v", err)
+			}
+			if !bytes.Equal(decompressed, payload) {
+				t.Error("decompressed payload does not match original")
+			}
+		})
+	}
+}
+
+func TestCompress_Unsupported(t *testing.T) {
+	if IsSupportedCompression("lz4") {
+		t.Error("IsSupportedCompression(lz4) = true, want false")
+	}
+	if _, err := Compress("lz4", []byte("x")); err == nil {
+		t.Error("Compress should fail for unsupported algorithm")
+	}
+	if _, err := Decompress("lz4", []byte("x")); err == nil {
+		t.Error("Decompress should fail for unsupported algorithm")
+	}
+}
+
+func TestDecompress_CorruptPayload(t *testing.T) {
+	for _, algorithm := range []string{constant.CompressionGzip, constant.CompressionSnappy} {
+		if _, err := Decompress(algorithm, []byte("not compressed")); err == nil {
+			t.Errorf("Decompress(%s) should fail for corrupt payload", algorithm)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncrypt_RoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	plaintext := []byte("sensitive payload")
+
+	ciphertext, err := Encrypt(key, plaintext, []byte("key-1"))
+	if err != nil {
+		t.Fatalf("Encrypt returned error: %v", err)
+	}
+	if bytes.Contains(ciphertext, plaintext) {
+		t.Error("ciphertext contains plaintext")
+	}
+
+	decrypted, err := Decrypt(key, ciphertext, []byte("key-1"))
+	if err != nil {
+		t.Fatalf("Decrypt returned error: %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Decrypt = %s, want %s", decrypted, plaintext)
+	}
+}
+
+func TestDecrypt_Failures(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	ciphertext, err := Encrypt(key, []byte("payload"), []byte("key-1"))
+	if err != nil {
+		t.Fatalf("Encrypt returned error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		key            []byte
+		ciphertext     []byte
+		additionalData []byte
+	}{
+		{name: "wrong key", key: bytes.Repeat([]byte{2}, 32), ciphertext: ciphertext, additionalData: []byte("key-1")},
+		{name: "wrong additional data", key: key, ciphertext: ciphertext, additionalData: []byte("key-2")},
+		{name: "short ciphertext", key: key, ciphertext: []byte{1, 2, 3}, additionalData: []byte("key-1")},
+		{name: "invalid key size", key: []byte("short"), ciphertext: ciphertext, additionalData: []byte("key-1")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decrypt(tt.key, tt.ciphertext, tt.additionalData); err == nil {
+				t.Error("Decrypt should return error")
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+func Sign(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func VerifySignature(key, data, signature []byte) bool {
+	return hmac.Equal(Sign(key, data), signature)
+}
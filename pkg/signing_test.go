@@ -0,0 +1,28 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestSign_Verify(t *testing.T) {
+	key := []byte("signing-key")
+	data := []byte("payload")
+
+	signature := Sign(key, data)
+	if len(signature) != 32 {
+		t.Errorf("signature length = %d, want 32", len(signature))
+	}
+
+	if !VerifySignature(key, data, signature) {
+		t.Error("VerifySignature = false, want true")
+	}
+	if VerifySignature([]byte("other-key"), data, signature) {
+		t.Error("VerifySignature with wrong key = true, want false")
+	}
+	if VerifySignature(key, []byte("tampered"), signature) {
+		t.Error("VerifySignature with tampered data = true, want false")
+	}
+	if VerifySignature(key, data, nil) {
+		t.Error("VerifySignature without signature = true, want false")
+	}
+}
@@ -7,3 +7,7 @@ import (
 func GetAssignmentPath(chanel, instanceId string) string {
 	return fmt.Sprintf("%s.%s", chanel, instanceId)
 }
+
+func GetAssignmentFieldPath(chanel, instanceId, field string) string {
+	return fmt.Sprintf("%s.%s", GetAssignmentPath(chanel, instanceId), field)
+}
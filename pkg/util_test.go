@@ -52,3 +52,10 @@ func TestGetAssignmentPath(t *testing.T) {
 		})
 	}
 }
+
+func TestGetAssignmentFieldPath(t *testing.T) {
+	result := GetAssignmentFieldPath("test-channel", "instance-123", "filter")
+	if result != "test-channel.instance-123.filter" {
+		t.Errorf("GetAssignmentFieldPath = %q, want %q", result, "test-channel.instance-123.filter")
+	}
+}
@@ -0,0 +1,85 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/couchbase/gocb/v2"
+	"github.com/halilbulentorhon/cb-pubsub/constant"
+	"github.com/halilbulentorhon/cb-pubsub/model"
+	"github.com/halilbulentorhon/cb-pubsub/repository"
+)
+
+var ErrQueueFull = errors.New("subscriber queue full")
+
+type QueueFullError struct {
+	Policy  string
+	Members []string
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("subscriber queue full for members %v (policy %s)", e.Members, e.Policy)
+}
+
+func (e *QueueFullError) Is(target error) bool {
+	return target == ErrQueueFull
+}
+
+func isSupportedQueueFullPolicy(policy string) bool {
+	switch policy {
+	case constant.QueueFullPolicyDropOldest, constant.QueueFullPolicyDropNewest,
+		constant.QueueFullPolicyReject, constant.QueueFullPolicyOverflow:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *cbPubSub[T]) queueDepths(ctx context.Context, members []string) (map[string]int, []string, error) {
+	depths := make(map[string]int, len(members))
+	saturated := make([]string, 0)
+
+	for _, member := range members {
+		depth, err := c.repository.ArrayCount(ctx, selfDocIdOf(member), constant.MessagesPath)
+		if errors.Is(err, gocb.ErrDocumentNotFound) {
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		depths[member] = depth
+		if depth >= c.cfg.MaxQueueDepth {
+			saturated = append(saturated, member)
+		}
+	}
+
+	return depths, saturated, nil
+}
+
+func (c *cbPubSub[T]) makeRoom(ctx context.Context, member string, envelope model.Message, overflow *model.Message) (model.Message, bool, error) {
+	switch c.cfg.QueueFullPolicy {
+	case constant.QueueFullPolicyDropNewest:
+		return envelope, false, nil
+	case constant.QueueFullPolicyOverflow:
+		if overflow.Blob == nil {
+			*overflow = envelope
+			if err := c.storeBlob(ctx, overflow); err != nil {
+				return envelope, false, err
+			}
+		}
+		return *overflow, true, nil
+	default:
+		err := c.removeHead(ctx, selfDocIdOf(member), func(state repository.ArrayState) int64 {
+			return int64(state.Count - c.cfg.MaxQueueDepth + 1)
+		})
+		if err != nil {
+			return envelope, false, fmt.Errorf("failed to drop oldest messages of member %s: %w", member, err)
+		}
+		return envelope, true, nil
+	}
+}
+
+func selfDocIdOf(instanceId string) string {
+	return fmt.Sprintf("%s%s", constant.SelfDocPrefix, instanceId)
+}
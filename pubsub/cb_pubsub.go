@@ -5,13 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/couchbase/gocb/v2"
 	"github.com/google/uuid"
+	"github.com/halilbulentorhon/cb-pubsub/codec"
 	"github.com/halilbulentorhon/cb-pubsub/config"
 	"github.com/halilbulentorhon/cb-pubsub/constant"
+	"github.com/halilbulentorhon/cb-pubsub/filter"
 	"github.com/halilbulentorhon/cb-pubsub/model"
+	"github.com/halilbulentorhon/cb-pubsub/notifier"
 	util "github.com/halilbulentorhon/cb-pubsub/pkg"
 	"github.com/halilbulentorhon/cb-pubsub/repository"
 )
@@ -19,18 +23,53 @@ import (
 type cbPubSub[T any] struct {
 	cfg                  config.PubSubConfig
 	repository           repository.Repository
+	codec                codec.Codec
+	keyProvider          KeyProvider
+	deadLetter           DeadLetterHandler
+	signing              *SigningConfig
+	orderingKey          func(msg T) string
+	notifier             notifier.ChangeNotifier
 	shutdownMgr          *shutdownManager
 	logger               util.Logger
 	subscribeRetryConfig util.RetryConfig
 	cleanupRetryConfig   util.RetryConfig
-	subscribeOnce        sync.Once
+	filters              sync.Map
 	channel              string
 	instanceId           string
 	selfDocId            string
-	isSubscribed         bool
+	metadata             model.MemberMetadata
+	filter               string
+	filterMu             sync.RWMutex
+	middlewares          []Middleware[T]
+	interceptors         []PublishInterceptor[T]
+	chainMu              sync.RWMutex
+	consumeErr           error
+	consumeMu            sync.Mutex
+	rejectedMessages     atomic.Uint64
+	saturatedDeliveries  atomic.Uint64
+	pollActivity         atomic.Int64
+	paused               atomic.Bool
+	leader               atomic.Bool
+	subscriptions        []*subscription[T]
+	loop                 *pollLoop
+	subsMu               sync.Mutex
+	membershipHooks      []func(MembershipEvent)
+	hooksMu              sync.RWMutex
+	knownMembers         map[string]knownMember
+	membershipMu         sync.Mutex
+	pollMu               sync.Mutex
+	draining             atomic.Bool
 }
 
-func (c *cbPubSub[T]) Publish(ctx context.Context, msg T) error {
+func (c *cbPubSub[T]) Publish(ctx context.Context, msg T, opts ...PublishOption) error {
+	publishOpts := applyPublishOptions(opts)
+	publish := func(ctx context.Context, msg T, headers map[string]string) error {
+		return c.publish(ctx, msg, headers, publishOpts.onSaturated)
+	}
+	return c.wrapPublish(publish)(ctx, msg, publishOpts.headers)
+}
+
+func (c *cbPubSub[T]) publish(ctx context.Context, msg T, headers map[string]string, onSaturated func([]string)) error {
 	var allDoc model.AssignmentDoc
 	_, err := c.repository.Get(ctx, constant.AssignmentDocName, &allDoc)
 	if err != nil {
@@ -42,106 +81,266 @@ func (c *cbPubSub[T]) Publish(ctx context.Context, msg T) error {
 		return fmt.Errorf("publish error, channel not found")
 	}
 
-	for member := range channel {
-		if member == c.instanceId {
-			continue
+	targets := c.publishTargets(channel, msg, headers)
+	if len(targets) == 0 {
+		return nil
+	}
+
+	var depths map[string]int
+	var saturated []string
+	if c.cfg.MaxQueueDepth > 0 {
+		depths, saturated, err = c.queueDepths(ctx, targets)
+		if err != nil {
+			return err
+		}
+		if len(saturated) > 0 && c.cfg.QueueFullPolicy == constant.QueueFullPolicyReject {
+			return &QueueFullError{Policy: c.cfg.QueueFullPolicy, Members: saturated}
+		}
+	}
+
+	envelope, err := c.encode(ctx, msg, headers)
+	if err != nil {
+		return err
+	}
+
+	var overflowEnvelope model.Message
+	for _, member := range targets {
+		memberEnvelope := envelope
+		if depth, found := depths[member]; found && depth >= c.cfg.MaxQueueDepth {
+			c.saturatedDeliveries.Add(1)
+			var deliver bool
+			memberEnvelope, deliver, err = c.makeRoom(ctx, member, envelope, &overflowEnvelope)
+			if err != nil {
+				return err
+			}
+			if !deliver {
+				continue
+			}
 		}
-		key := fmt.Sprintf("%s%s", constant.SelfDocPrefix, member)
-		err = c.repository.ArrayAppend(ctx, key, constant.MessagesPath, msg)
+
+		err = c.repository.ArrayAppend(ctx, selfDocIdOf(member), constant.MessagesPath, memberEnvelope)
 		if errors.Is(err, gocb.ErrDocumentNotFound) {
 			continue
 		} else if err != nil {
 			return err
 		}
+		if publisher, ok := c.notifier.(notifier.Publisher); ok {
+			publisher.Notify(selfDocIdOf(member))
+		}
+	}
+
+	if len(saturated) > 0 {
+		c.logger.Warn("published to saturated members", "members", saturated, "policy", c.cfg.QueueFullPolicy)
+		if onSaturated != nil {
+			onSaturated(saturated)
+		}
 	}
 
 	return nil
 }
 
+func (c *cbPubSub[T]) publishTargets(channel map[string]model.AssignmentEntry, msg T, headers map[string]string) []string {
+	targets := make([]string, 0, len(channel))
+
+	var fields map[string]any
+	fieldsResolved := false
+	for member, entry := range channel {
+		if member == c.instanceId {
+			continue
+		}
+		if entry.Filter != "" {
+			if !fieldsResolved {
+				fields = filter.FieldsOf(msg)
+				fieldsResolved = true
+			}
+			if !c.matchesFilter(member, entry.Filter, headers, fields) {
+				continue
+			}
+		}
+		targets = append(targets, member)
+	}
+
+	return targets
+}
+
+func (c *cbPubSub[T]) matchesFilter(member, expr string, headers map[string]string, fields map[string]any) bool {
+	f, err := c.compileFilter(expr)
+	if err != nil {
+		c.logger.Warn("ignoring invalid member filter", "member_id", member, "filter", expr, "error", err)
+		return true
+	}
+	return f.Match(headers, fields)
+}
+
+func (c *cbPubSub[T]) compileFilter(expr string) (*filter.Filter, error) {
+	if cached, found := c.filters.Load(expr); found {
+		return cached.(*filter.Filter), nil
+	}
+
+	f, err := filter.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	c.filters.Store(expr, f)
+	return f, nil
+}
+
+func (c *cbPubSub[T]) SetFilter(ctx context.Context, expr string) error {
+	if expr != "" {
+		if _, err := c.compileFilter(expr); err != nil {
+			return fmt.Errorf("invalid filter: %w", err)
+		}
+	}
+
+	c.filterMu.Lock()
+	c.filter = expr
+	c.filterMu.Unlock()
+
+	path := util.GetAssignmentFieldPath(c.channel, c.instanceId, constant.FilterField)
+	return c.repository.UpsertPath(ctx, constant.AssignmentDocName, path, expr)
+}
+
+func (c *cbPubSub[T]) Pause(ctx context.Context) error {
+	return c.setPaused(ctx, true)
+}
+
+func (c *cbPubSub[T]) Resume(ctx context.Context) error {
+	return c.setPaused(ctx, false)
+}
+
+func (c *cbPubSub[T]) IsPaused() bool {
+	return c.paused.Load()
+}
+
+func (c *cbPubSub[T]) setPaused(ctx context.Context, paused bool) error {
+	if c.paused.Swap(paused) == paused {
+		return nil
+	}
+
+	path := util.GetAssignmentFieldPath(c.channel, c.instanceId, constant.PausedField)
+	err := c.repository.UpsertPath(ctx, constant.AssignmentDocName, path, paused)
+	if err != nil {
+		c.paused.Store(!paused)
+		return err
+	}
+
+	c.logger.Info("subscription pause state changed", "paused", paused, "instance_id", c.instanceId)
+	return nil
+}
+
+func (c *cbPubSub[T]) Stats() Stats {
+	return Stats{
+		RejectedMessages:    c.rejectedMessages.Load(),
+		SaturatedDeliveries: c.saturatedDeliveries.Load(),
+	}
+}
+
 func (c *cbPubSub[T]) Subscribe(ctx context.Context, handler PubSubHandler[T]) error {
-	if c.isSubscribed {
-		return errors.New("subscribe already called")
+	if c.shutdownMgr.IsClosed() {
+		return ErrClosed
 	}
 
-	var subscribeErr error
-	c.subscribeOnce.Do(func() {
-		c.isSubscribed = true
-		subscribeErr = c.doSubscribe(ctx, handler)
-	})
+	sub, loop := c.subscribe(ctx, c.wrapHandler(handler))
+	defer c.removeSubscription(sub)
 
-	return subscribeErr
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-loop.done:
+		return loop.err
+	}
 }
 
-func (c *cbPubSub[T]) doSubscribe(ctx context.Context, handler PubSubHandler[T]) error {
-	ticker := time.NewTicker(time.Duration(c.cfg.PollIntervalSeconds) * time.Second)
-	defer ticker.Stop()
+func (c *cbPubSub[T]) doSubscribe(loop *pollLoop) error {
+	ctx := c.shutdownMgr.Context()
+	interval := c.cfg.MinPollInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	c.markPollActivity()
+
+	var changes <-chan struct{}
+	if c.notifier != nil {
+		var stop func()
+		changes, stop = c.notifier.Watch(c.selfDocId)
+		defer stop()
+	}
 
 	for {
+		received := false
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		case <-c.shutdownMgr.Context().Done():
-			return errors.New("graceful shutdown")
-		case sig := <-c.shutdownMgr.SignalChannel():
-			c.logger.Info("graceful shutdown initiated", "signal", sig.String())
-			_ = c.Close()
-			return errors.New("graceful shutdown")
-		case <-ticker.C:
-			var selfDoc model.PubSubDoc[T]
-			selfDocTTL := time.Duration(constant.SelfDocTtlSeconds) * time.Second
-
-			err := util.WithRetry(ctx, c.subscribeRetryConfig, func() error {
-				_, err := c.repository.GetAndTouch(ctx, c.selfDocId, &selfDoc, selfDocTTL)
-				if errors.Is(err, gocb.ErrDocumentNotFound) {
-					c.logger.Info("self document not found, recreating...", "instance_id", c.instanceId, "channel", c.channel)
-					return c.assign(ctx)
-				}
-				return err
-			})
-
-			if err != nil {
-				c.logger.Error("failed to get self document after retries, shutting down", "error", err, "instance_id", c.instanceId, "channel", c.channel)
-				return fmt.Errorf("subscribe failed after retries: %w", err)
-			}
-
-			messageCount := len(selfDoc.Messages)
-			if messageCount == 0 {
+			return ErrShutdown
+		case _, ok := <-changes:
+			if !ok {
+				c.logger.Warn("change notifier closed, falling back to polling", "instance_id", c.instanceId)
+				changes = nil
 				continue
 			}
-
-			err = handler(selfDoc.Messages)
-			if err != nil {
-				c.logger.Error("pubsub handler error", "error", err, "message_count", messageCount, "instance_id", c.instanceId)
-				continue
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
 			}
+			received = true
+		case <-timer.C:
+		}
 
-			err = util.WithRetry(ctx, c.subscribeRetryConfig, func() error {
-				return c.repository.ArrayRemoveFromIndex(ctx, c.selfDocId, constant.MessagesPath, 0, messageCount-1)
-			})
-			if err != nil {
-				c.logger.Error("failed to remove processed messages after retries", "error", err, "message_count", messageCount, "instance_id", c.instanceId)
-				continue
-			}
+		if c.stopIfIdle(loop) {
+			return nil
+		}
+		c.markPollActivity()
+		polled, err := c.poll(ctx)
+		if err != nil {
+			return err
 		}
+		interval = c.nextPollInterval(interval, received || polled)
+		timer.Reset(interval)
 	}
 }
 
-func (c *cbPubSub[T]) Close() error {
-	var repoErr error
+func (c *cbPubSub[T]) watchLifecycle(lifecycle context.Context) {
+	select {
+	case <-c.shutdownMgr.Context().Done():
+		return
+	case sig := <-c.shutdownMgr.SignalChannel():
+		c.logger.Info("graceful shutdown initiated", "signal", sig.String())
+	case <-lifecycle.Done():
+		c.logger.Info("graceful shutdown initiated", "reason", context.Cause(lifecycle))
+	}
+	_ = c.Close(context.Background())
+}
 
-	err := c.shutdownMgr.Shutdown(func(shutdownCtx context.Context) {
-		if c.repository != nil {
-			_ = c.repository.Delete(shutdownCtx, c.selfDocId)
-			pathToRemove := util.GetAssignmentPath(c.channel, c.instanceId)
-			_ = c.repository.RemoveMultiplePaths(shutdownCtx, constant.AssignmentDocName, []string{pathToRemove})
-			repoErr = c.repository.Close()
+func (c *cbPubSub[T]) nextPollInterval(current time.Duration, received bool) time.Duration {
+	if received {
+		return c.cfg.MinPollInterval
+	}
+	next := time.Duration(float64(current) * constant.PollBackoffMultiplier)
+	return min(max(next, c.cfg.MinPollInterval), c.cfg.MaxPollInterval)
+}
+
+func (c *cbPubSub[T]) Close(ctx context.Context) error {
+	return c.shutdownMgr.Shutdown(ctx, func(shutdownCtx context.Context) error {
+		if c.repository == nil {
+			return nil
 		}
-	})
 
-	if err != nil {
-		return err
-	}
-	return repoErr
+		var errs []error
+		c.resign(shutdownCtx)
+		err := c.repository.Delete(shutdownCtx, c.selfDocId)
+		if err != nil && !errors.Is(err, gocb.ErrDocumentNotFound) {
+			errs = append(errs, fmt.Errorf("failed to delete self document: %w", err))
+		}
+		pathToRemove := util.GetAssignmentPath(c.channel, c.instanceId)
+		err = c.repository.RemoveMultiplePaths(shutdownCtx, constant.AssignmentDocName, []string{pathToRemove})
+		if err != nil && !errors.Is(err, gocb.ErrPathNotFound) && !errors.Is(err, gocb.ErrDocumentNotFound) {
+			errs = append(errs, fmt.Errorf("failed to remove assignment entry: %w", err))
+		}
+		if err = c.repository.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close repository: %w", err))
+		}
+		return errors.Join(errs...)
+	})
 }
 
 func (c *cbPubSub[T]) cleanOldMembers() error {
@@ -150,6 +349,8 @@ func (c *cbPubSub[T]) cleanOldMembers() error {
 	defer ticker.Stop()
 
 	consecutiveFailures := 0
+	reconcileInterval := time.Duration(c.cfg.ReconcileIntervalSeconds) * time.Second
+	var lastReconcile time.Time
 
 	for {
 		select {
@@ -157,21 +358,32 @@ func (c *cbPubSub[T]) cleanOldMembers() error {
 			return c.shutdownMgr.Context().Err()
 		case <-ticker.C:
 			err := util.WithRetry(c.shutdownMgr.Context(), c.cleanupRetryConfig, func() error {
-				return c.performCleanup(c.shutdownMgr.Context())
+				leader, err := c.campaign(c.shutdownMgr.Context())
+				if err != nil || !leader {
+					return err
+				}
+				if time.Since(lastReconcile) < reconcileInterval {
+					return c.performCleanup(c.shutdownMgr.Context())
+				}
+				if _, err = c.Reconcile(c.shutdownMgr.Context()); err != nil {
+					return err
+				}
+				lastReconcile = time.Now()
+				return nil
 			})
 
 			if err != nil {
 				consecutiveFailures++
 				c.logger.Error("cleanup failed after retries", "error", err, "consecutive_failures", consecutiveFailures, "instance_id", c.instanceId)
 
-				if consecutiveFailures >= constant.MaxConsecutiveFailures {
+				if consecutiveFailures >= c.cfg.MaxConsecutiveFailures {
 					c.logger.Error("cleanup failed too many times, triggering shutdown", "consecutive_failures", consecutiveFailures, "instance_id", c.instanceId)
 					return fmt.Errorf("cleanup failed %d consecutive times: %w", consecutiveFailures, err)
 				}
 
-				newInterval := time.Duration(float64(cleanupInterval) * constant.CleanupIntervalMultiplier)
-				if newInterval > constant.MaxCleanupInterval {
-					newInterval = constant.MaxCleanupInterval
+				newInterval := time.Duration(float64(cleanupInterval) * c.cfg.CleanupBackoffMultiplier)
+				if newInterval > c.cfg.MaxCleanupInterval {
+					newInterval = c.cfg.MaxCleanupInterval
 				}
 				ticker.Reset(newInterval)
 				c.logger.Warn("cleanup interval increased due to failures", "new_interval", newInterval, "consecutive_failures", consecutiveFailures)
@@ -193,13 +405,12 @@ func (c *cbPubSub[T]) performCleanup(ctx context.Context) error {
 		return fmt.Errorf("failed to get assignment document: %w", err)
 	}
 
+	now := time.Now()
 	inactiveMembers := make([]string, 0)
 	for channel, memberMap := range allDoc {
-		for memberId := range memberMap {
-			var res interface{}
-			_, err = c.repository.Get(ctx, fmt.Sprintf("%s%s", constant.SelfDocPrefix, memberId), &res)
-			if errors.Is(err, gocb.ErrDocumentNotFound) {
-				c.logger.Debug("inactive member detected", "member_id", memberId, "channel", channel)
+		for memberId, entry := range memberMap {
+			if c.isExpired(entry.Timestamp, now) {
+				c.logger.Debug("inactive member detected", "member_id", memberId, "channel", channel, "last_heartbeat", entry.Timestamp)
 				inactiveMembers = append(inactiveMembers, fmt.Sprintf("%s.%s", channel, memberId))
 			}
 		}
@@ -214,28 +425,61 @@ func (c *cbPubSub[T]) performCleanup(ctx context.Context) error {
 		c.logger.Info("cleaned up inactive members", "count", len(inactiveMembers), "members", inactiveMembers)
 	}
 
+	c.observeMembers(c.withoutExpired(allDoc, now), now)
 	return nil
 }
 
-func (c *cbPubSub[T]) assign(ctx context.Context) error {
-	selfDocTTL := time.Duration(constant.SelfDocTtlSeconds) * time.Second
+func (c *cbPubSub[T]) selfDocTtl() time.Duration {
+	return time.Duration(c.cfg.SelfDocTtlSeconds) * time.Second
+}
 
-	err := c.repository.Upsert(ctx, c.selfDocId, model.CreatePubSubDoc[T](), selfDocTTL)
+func (c *cbPubSub[T]) assign(ctx context.Context) error {
+	err := c.repository.Upsert(ctx, c.selfDocId, model.CreatePubSubDoc[model.Message](), c.selfDocTtl())
 	if err != nil {
 		return err
 	}
 
-	currentTimestamp := time.Now().Unix()
-	err = c.repository.UpsertPath(ctx, constant.AssignmentDocName, util.GetAssignmentPath(c.channel, c.instanceId), currentTimestamp)
-	if err != nil {
-		return err
+	return c.register(ctx)
+}
+
+func (c *cbPubSub[T]) register(ctx context.Context) error {
+	if c.draining.Load() {
+		return nil
 	}
 
-	return nil
+	c.filterMu.RLock()
+	entry := model.CreateAssignmentEntry(c.filter)
+	c.filterMu.RUnlock()
+	entry.Paused = c.paused.Load()
+	entry.MemberMetadata = c.metadata
+
+	return c.repository.UpsertPath(ctx, constant.AssignmentDocName, util.GetAssignmentPath(c.channel, c.instanceId), entry)
 }
 
-func NewCbPubSub[T any](channel string, cfg config.PubSubConfig) (PubSub[T], error) {
+func NewCbPubSub[T any](channel string, cfg config.PubSubConfig, opts ...Option) (PubSub[T], error) {
 	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Compression != "" && !util.IsSupportedCompression(cfg.Compression) {
+		return nil, fmt.Errorf("unsupported compression %q", cfg.Compression)
+	}
+	if !isSupportedQueueFullPolicy(cfg.QueueFullPolicy) {
+		return nil, fmt.Errorf("unsupported queue full policy %q", cfg.QueueFullPolicy)
+	}
+	o := applyOptions(opts)
+	var orderingKey func(msg T) string
+	if o.orderingKey != nil {
+		var ok bool
+		if orderingKey, ok = o.orderingKey.(func(msg T) string); !ok {
+			return nil, fmt.Errorf("ordering key function %T does not match message type", o.orderingKey)
+		}
+	}
+	if o.signing != nil {
+		if _, found := o.signing.Keys[o.signing.KeyId]; !found {
+			return nil, fmt.Errorf("signing key %q not found", o.signing.KeyId)
+		}
+	}
 
 	id := uuid.NewString()
 	logger := util.NewLogger("cb-pubsub").With("instance_id", id, "channel", channel)
@@ -244,9 +488,16 @@ func NewCbPubSub[T any](channel string, cfg config.PubSubConfig) (PubSub[T], err
 		cfg:         cfg,
 		channel:     channel,
 		instanceId:  id,
-		selfDocId:   fmt.Sprintf("%s%s", constant.SelfDocPrefix, id),
+		selfDocId:   selfDocIdOf(id),
+		metadata:    newMemberMetadata(o),
 		logger:      logger,
-		shutdownMgr: newShutdownManager(logger.With("component", "shutdown-manager")),
+		codec:       o.codec,
+		keyProvider: o.keyProvider,
+		deadLetter:  o.deadLetter,
+		signing:     o.signing,
+		orderingKey: orderingKey,
+		notifier:    o.notifier,
+		shutdownMgr: newShutdownManager(logger.With("component", "shutdown-manager"), time.Duration(cfg.ShutdownTimeoutSec)*time.Second),
 		subscribeRetryConfig: util.RetryConfig{
 			MaxRetries:   cfg.SubscribeRetryAttempts,
 			InitialDelay: constant.DefaultSubscribeRetryInitialDelay,
@@ -272,14 +523,23 @@ func NewCbPubSub[T any](channel string, cfg config.PubSubConfig) (PubSub[T], err
 
 	err = cbPS.assign(initCtx)
 	if err != nil {
+		if delErr := repo.Delete(initCtx, cbPS.selfDocId); delErr != nil && !errors.Is(delErr, gocb.ErrDocumentNotFound) {
+			logger.Warn("failed to delete self document after failed assignment", "error", delErr)
+		}
 		return nil, err
 	}
 
+	if cfg.HandleSignals {
+		cbPS.shutdownMgr.HandleSignals()
+	}
+	go cbPS.watchLifecycle(o.lifecycle)
+	go cbPS.heartbeat()
+
 	go func() {
-		err = cbPS.cleanOldMembers()
+		err := cbPS.cleanOldMembers()
 		if err != nil && !errors.Is(err, context.Canceled) {
 			cbPS.logger.Error("cleanOldMembers failed, initiating graceful shutdown", "error", err)
-			_ = cbPS.Close()
+			_ = cbPS.Close(context.Background())
 		}
 	}()
 
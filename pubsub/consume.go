@@ -0,0 +1,103 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrShutdown = fmt.Errorf("graceful shutdown: %w", ErrClosed)
+
+type Delivery[T any] struct {
+	Message T
+	acked   chan struct{}
+	once    *sync.Once
+}
+
+func newDelivery[T any](msg T) Delivery[T] {
+	return Delivery[T]{Message: msg, acked: make(chan struct{}), once: &sync.Once{}}
+}
+
+func (d Delivery[T]) Ack() {
+	d.once.Do(func() {
+		close(d.acked)
+	})
+}
+
+type partialError struct {
+	completed int
+	cause     error
+}
+
+func (e *partialError) Error() string {
+	return fmt.Sprintf("handler completed %d messages: %v", e.completed, e.cause)
+}
+
+func (e *partialError) Unwrap() error {
+	return e.cause
+}
+
+func (c *cbPubSub[T]) Messages(ctx context.Context) <-chan Delivery[T] {
+	out := make(chan Delivery[T])
+
+	go func() {
+		defer close(out)
+		err := c.Subscribe(ctx, func(handlerCtx context.Context, messages []T) error {
+			return c.deliver(handlerCtx, out, messages)
+		})
+		c.consumeMu.Lock()
+		c.consumeErr = err
+		c.consumeMu.Unlock()
+	}()
+
+	return out
+}
+
+func (c *cbPubSub[T]) Err() error {
+	c.consumeMu.Lock()
+	defer c.consumeMu.Unlock()
+	if errors.Is(c.consumeErr, context.Canceled) || errors.Is(c.consumeErr, ErrClosed) {
+		return nil
+	}
+	return c.consumeErr
+}
+
+func (c *cbPubSub[T]) deliver(ctx context.Context, out chan<- Delivery[T], messages []T) error {
+	var pending *Delivery[T]
+	for i, msg := range messages {
+		delivery := newDelivery(msg)
+		select {
+		case out <- delivery:
+		case <-ctx.Done():
+			return &partialError{completed: ackedCount(pending, i), cause: ctx.Err()}
+		case <-c.shutdownMgr.Context().Done():
+			return &partialError{completed: ackedCount(pending, i), cause: ErrShutdown}
+		}
+		if pending != nil {
+			pending.Ack()
+		}
+		pending = &delivery
+	}
+
+	select {
+	case <-pending.acked:
+		return nil
+	case <-ctx.Done():
+		return &partialError{completed: ackedCount(pending, len(messages)), cause: ctx.Err()}
+	case <-c.shutdownMgr.Context().Done():
+		return &partialError{completed: ackedCount(pending, len(messages)), cause: ErrShutdown}
+	}
+}
+
+func ackedCount[T any](pending *Delivery[T], delivered int) int {
+	if pending == nil {
+		return 0
+	}
+	select {
+	case <-pending.acked:
+		return delivered
+	default:
+		return delivered - 1
+	}
+}
@@ -0,0 +1,28 @@
+//go:build go1.23
+
+package pubsub
+
+import (
+	"context"
+	"iter"
+)
+
+func All[T any](ctx context.Context, ps PubSub[T]) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		for delivery := range ps.Messages(ctx) {
+			more := yield(delivery.Message, nil)
+			delivery.Ack()
+			if !more {
+				return
+			}
+		}
+
+		if err := ps.Err(); err != nil {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+//go:build go1.23
+
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"github.com/halilbulentorhon/cb-pubsub/mocks"
+	"github.com/halilbulentorhon/cb-pubsub/model"
+	"go.uber.org/mock/gomock"
+)
+
+func TestAll(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	mockRepo.EXPECT().
+		GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
+			doc := result.(*model.PubSubDoc[model.Message])
+			doc.Messages = []model.Message{testEnvelope(t, "msg1", nil), testEnvelope(t, "msg2", nil)}
+			return gocb.Cas(1), nil
+		})
+	removed := make(chan struct{})
+	expectAck(mockRepo, pubsub.selfDocId, 0, 2).
+		DoAndReturn(func(ctx context.Context, key, path, seqPath string, count int, cas gocb.Cas) error {
+			close(removed)
+			return nil
+		})
+
+	var received []string
+	for msg, err := range All[string](context.Background(), pubsub) {
+		if err != nil {
+			t.Fatalf("All yielded error: %v", err)
+		}
+		received = append(received, msg)
+		if len(received) == 2 {
+			break
+		}
+	}
+
+	select {
+	case <-removed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("acknowledged messages were not removed")
+	}
+	if len(received) != 2 || received[0] != "msg1" || received[1] != "msg2" {
+		t.Errorf("received = %v, want [msg1 msg2]", received)
+	}
+}
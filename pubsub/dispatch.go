@@ -0,0 +1,99 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+)
+
+type dispatchItem[T any] struct {
+	msg   T
+	key   string
+	index int
+}
+
+func (c *cbPubSub[T]) dispatch(ctx context.Context, handler PubSubHandler[T], messages []T, positions []int, total int) int {
+	if c.cfg.HandlerConcurrency <= 1 {
+		err := c.invoke(ctx, handler, messages)
+		if err != nil {
+			c.logger.Error("pubsub handler error", "error", err, "message_count", len(messages), "instance_id", c.instanceId)
+			var partial *partialError
+			if errors.As(err, &partial) && partial.completed > 0 {
+				return completedPrefix(partial.completed, positions, total)
+			}
+			return positions[0]
+		}
+		return total
+	}
+
+	results := c.runWorkers(ctx, handler, messages)
+	for i, err := range results {
+		if err != nil {
+			return positions[i]
+		}
+	}
+	return total
+}
+
+func completedPrefix(completed int, positions []int, total int) int {
+	if completed >= len(positions) {
+		return total
+	}
+	return positions[completed]
+}
+
+func (c *cbPubSub[T]) runWorkers(ctx context.Context, handler PubSubHandler[T], messages []T) []error {
+	workers := min(c.cfg.HandlerConcurrency, len(messages))
+	queues := make([]chan dispatchItem[T], workers)
+	for i := range queues {
+		queues[i] = make(chan dispatchItem[T], len(messages))
+	}
+
+	for i, msg := range messages {
+		item := dispatchItem[T]{msg: msg, index: i}
+		queue := i % workers
+		if c.orderingKey != nil {
+			item.key = c.orderingKey(msg)
+			queue = workerFor(item.key, workers)
+		}
+		queues[queue] <- item
+	}
+
+	results := make([]error, len(messages))
+	var wg sync.WaitGroup
+	for _, queue := range queues {
+		close(queue)
+		wg.Add(1)
+		go func(queue chan dispatchItem[T]) {
+			defer wg.Done()
+			failedKeys := make(map[string]error)
+			for item := range queue {
+				if err, failed := failedKeys[item.key]; failed && c.orderingKey != nil {
+					results[item.index] = err
+					continue
+				}
+				if err := ctx.Err(); err != nil {
+					results[item.index] = err
+					continue
+				}
+
+				err := c.invoke(ctx, handler, []T{item.msg})
+				if err != nil {
+					c.logger.Error("pubsub handler error", "error", err, "message_index", item.index, "instance_id", c.instanceId)
+					results[item.index] = err
+					failedKeys[item.key] = err
+				}
+			}
+		}(queue)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func workerFor(key string, workers int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(workers))
+}
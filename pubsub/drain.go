@@ -0,0 +1,67 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/halilbulentorhon/cb-pubsub/constant"
+	util "github.com/halilbulentorhon/cb-pubsub/pkg"
+)
+
+var ErrDrainInProgress = errors.New("drain already in progress")
+
+func (c *cbPubSub[T]) Drain(ctx context.Context) error {
+	if c.shutdownMgr.IsClosed() {
+		return ErrClosed
+	}
+	if c.draining.Swap(true) {
+		return ErrDrainInProgress
+	}
+
+	c.logger.Info("draining subscription", "instance_id", c.instanceId)
+	path := util.GetAssignmentPath(c.channel, c.instanceId)
+	err := c.repository.RemoveMultiplePaths(ctx, constant.AssignmentDocName, []string{path})
+	if err != nil {
+		c.draining.Store(false)
+		return fmt.Errorf("failed to deregister before drain: %w", err)
+	}
+
+	drainErr := c.drainSelfDoc(ctx)
+	if drainErr != nil {
+		c.logger.Warn("drain stopped before the self document was empty", "error", drainErr, "instance_id", c.instanceId)
+	}
+
+	return errors.Join(drainErr, c.Close(context.WithoutCancel(ctx)))
+}
+
+func (c *cbPubSub[T]) drainSelfDoc(ctx context.Context) error {
+	if len(c.activeSubscriptions()) == 0 {
+		c.logger.Warn("no active subscriptions, discarding remaining messages", "instance_id", c.instanceId)
+		return nil
+	}
+
+	for round := 0; ; round++ {
+		if round > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.cfg.MinPollInterval):
+			}
+		}
+
+		c.pollMu.Lock()
+		received, err := c.receive(ctx)
+		c.pollMu.Unlock()
+		if err != nil {
+			return err
+		}
+		if !received {
+			return nil
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
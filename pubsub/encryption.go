@@ -0,0 +1,46 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrDecryptionFailed = errors.New("message decryption failed")
+
+type KeyProvider interface {
+	CurrentKey(ctx context.Context) (keyId string, key []byte, err error)
+	Key(ctx context.Context, keyId string) ([]byte, error)
+}
+
+type staticKeyProvider struct {
+	keys         map[string][]byte
+	currentKeyId string
+}
+
+func (p *staticKeyProvider) CurrentKey(ctx context.Context) (string, []byte, error) {
+	key, err := p.Key(ctx, p.currentKeyId)
+	if err != nil {
+		return "", nil, err
+	}
+	return p.currentKeyId, key, nil
+}
+
+func (p *staticKeyProvider) Key(_ context.Context, keyId string) ([]byte, error) {
+	key, found := p.keys[keyId]
+	if !found {
+		return nil, fmt.Errorf("encryption key %q not found", keyId)
+	}
+	return key, nil
+}
+
+func NewStaticKeyProvider(currentKeyId string, keys map[string][]byte) KeyProvider {
+	copied := make(map[string][]byte, len(keys))
+	for id, key := range keys {
+		copied[id] = key
+	}
+	return &staticKeyProvider{
+		keys:         copied,
+		currentKeyId: currentKeyId,
+	}
+}
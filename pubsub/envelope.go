@@ -0,0 +1,153 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/halilbulentorhon/cb-pubsub/codec"
+	"github.com/halilbulentorhon/cb-pubsub/model"
+	util "github.com/halilbulentorhon/cb-pubsub/pkg"
+)
+
+func (c *cbPubSub[T]) encode(ctx context.Context, msg T, headers map[string]string) (model.Message, error) {
+	payload, err := c.codec.Marshal(msg)
+	if err != nil {
+		return model.Message{}, fmt.Errorf("failed to encode message with codec %s: %w", c.codec.Name(), err)
+	}
+
+	envelope := model.Message{
+		Headers: headers,
+		Codec:   c.codec.Name(),
+		Payload: payload,
+	}
+
+	if c.cfg.Compression != "" && len(payload) >= c.cfg.CompressionThresholdBytes {
+		compressed, err := util.Compress(c.cfg.Compression, payload)
+		if err != nil {
+			return model.Message{}, err
+		}
+		if len(compressed) < len(payload) {
+			envelope.Encoding = c.cfg.Compression
+			envelope.Payload = compressed
+		}
+	}
+
+	if c.keyProvider != nil {
+		keyId, key, err := c.keyProvider.CurrentKey(ctx)
+		if err != nil {
+			return model.Message{}, fmt.Errorf("failed to get current encryption key: %w", err)
+		}
+		encrypted, err := util.Encrypt(key, envelope.Payload, []byte(keyId))
+		if err != nil {
+			return model.Message{}, fmt.Errorf("failed to encrypt message with key %s: %w", keyId, err)
+		}
+		envelope.KeyId = keyId
+		envelope.Payload = encrypted
+	}
+
+	if c.signing != nil {
+		if err = c.sign(&envelope); err != nil {
+			return model.Message{}, err
+		}
+	}
+
+	if err = c.offload(ctx, &envelope); err != nil {
+		return model.Message{}, err
+	}
+
+	return envelope, nil
+}
+
+func (c *cbPubSub[T]) decode(ctx context.Context, envelope model.Message) (T, error) {
+	var msg T
+
+	msgCodec := c.codec
+	if envelope.Codec == "" {
+		msgCodec = codec.JSON{}
+	} else if envelope.Codec != msgCodec.Name() {
+		builtin, found := codec.ByName(envelope.Codec)
+		if !found {
+			return msg, fmt.Errorf("unknown codec %q", envelope.Codec)
+		}
+		msgCodec = builtin
+	}
+
+	payload := envelope.Payload
+	if envelope.KeyId != "" {
+		decrypted, err := c.decrypt(ctx, envelope.KeyId, payload)
+		if err != nil {
+			return msg, err
+		}
+		payload = decrypted
+	}
+
+	if envelope.Encoding != "" {
+		decompressed, err := util.Decompress(envelope.Encoding, payload)
+		if err != nil {
+			return msg, err
+		}
+		payload = decompressed
+	}
+
+	err := msgCodec.Unmarshal(payload, &msg)
+	if err != nil {
+		return msg, fmt.Errorf("failed to decode message with codec %s: %w", msgCodec.Name(), err)
+	}
+	return msg, nil
+}
+
+func (c *cbPubSub[T]) decrypt(ctx context.Context, keyId string, payload []byte) ([]byte, error) {
+	if c.keyProvider == nil {
+		return nil, fmt.Errorf("%w: no key provider configured for key %s", ErrDecryptionFailed, keyId)
+	}
+
+	key, err := c.keyProvider.Key(ctx, keyId)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+	}
+
+	decrypted, err := util.Decrypt(key, payload, []byte(keyId))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
+	}
+	return decrypted, nil
+}
+
+func (c *cbPubSub[T]) decodeAll(ctx context.Context, envelopes []model.Message) ([]T, []int) {
+	messages := make([]T, 0, len(envelopes))
+	positions := make([]int, 0, len(envelopes))
+	for i, envelope := range envelopes {
+		if err := c.restore(ctx, &envelope); err != nil {
+			c.rejectMessage(ctx, envelope, err, i, true)
+			continue
+		}
+
+		if c.signing != nil {
+			if err := c.verify(envelope); err != nil {
+				c.rejectMessage(ctx, envelope, err, i, c.signing.Policy == SignaturePolicyDeadLetter)
+				continue
+			}
+		}
+
+		msg, err := c.decode(ctx, envelope)
+		if err != nil {
+			c.rejectMessage(ctx, envelope, err, i, true)
+			continue
+		}
+		messages = append(messages, msg)
+		positions = append(positions, i)
+	}
+	return messages, positions
+}
+
+func (c *cbPubSub[T]) rejectMessage(ctx context.Context, envelope model.Message, cause error, index int, deadLetter bool) {
+	c.rejectedMessages.Add(1)
+
+	if !deadLetter || c.deadLetter == nil {
+		c.logger.Error("dropping undeliverable message", "error", cause, "index", index, "instance_id", c.instanceId)
+		return
+	}
+
+	c.logger.Warn("sending undeliverable message to dead letter handler", "error", cause, "index", index, "instance_id", c.instanceId)
+	c.deadLetter(ctx, envelope, cause)
+}
@@ -0,0 +1,33 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("handler panicked: %v", e.Value)
+}
+
+func (c *cbPubSub[T]) invoke(ctx context.Context, handler PubSubHandler[T], messages []T) (err error) {
+	c.markPollActivity()
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.cfg.HandlerTimeoutSec)*time.Second)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr := &PanicError{Value: r, Stack: debug.Stack()}
+			c.logger.Error("recovered from handler panic", "panic", r, "stack", string(panicErr.Stack), "message_count", len(messages), "instance_id", c.instanceId)
+			err = panicErr
+		}
+	}()
+
+	return handler(ctx, messages)
+}
@@ -0,0 +1,66 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"github.com/halilbulentorhon/cb-pubsub/constant"
+	util "github.com/halilbulentorhon/cb-pubsub/pkg"
+)
+
+func (c *cbPubSub[T]) heartbeat() {
+	ticker := time.NewTicker(time.Duration(c.cfg.HeartbeatIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.shutdownMgr.Context().Done():
+			return
+		case <-ticker.C:
+			if c.pollLoopAlive(time.Now()) {
+				c.refreshHeartbeat(c.shutdownMgr.Context())
+			}
+			if err := c.watchMembers(c.shutdownMgr.Context()); err != nil && !errors.Is(err, context.Canceled) {
+				c.logger.Warn("failed to read membership", "error", err, "instance_id", c.instanceId)
+			}
+		}
+	}
+}
+
+func (c *cbPubSub[T]) markPollActivity() {
+	c.pollActivity.Store(time.Now().UnixNano())
+}
+
+func (c *cbPubSub[T]) pollLoopAlive(now time.Time) bool {
+	c.subsMu.Lock()
+	running := c.loop != nil
+	c.subsMu.Unlock()
+	if !running {
+		return false
+	}
+
+	stall := time.Duration(c.cfg.HandlerTimeoutSec+c.cfg.HeartbeatIntervalSeconds)*time.Second + c.cfg.MaxPollInterval
+	return now.Sub(time.Unix(0, c.pollActivity.Load())) <= stall
+}
+
+func (c *cbPubSub[T]) refreshHeartbeat(ctx context.Context) {
+	if err := c.beat(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		c.logger.Warn("failed to refresh heartbeat", "error", err, "instance_id", c.instanceId)
+	}
+}
+
+func (c *cbPubSub[T]) beat(ctx context.Context) error {
+	path := util.GetAssignmentFieldPath(c.channel, c.instanceId, constant.TimestampField)
+	err := c.repository.UpsertPath(ctx, constant.AssignmentDocName, path, time.Now().Unix())
+	if errors.Is(err, gocb.ErrPathNotFound) || errors.Is(err, gocb.ErrDocumentNotFound) {
+		c.logger.Info("assignment entry not found, re-registering...", "instance_id", c.instanceId, "channel", c.channel)
+		return c.register(ctx)
+	}
+	return err
+}
+
+func (c *cbPubSub[T]) isExpired(timestamp int64, now time.Time) bool {
+	return now.Sub(time.Unix(timestamp, 0)) > time.Duration(c.cfg.HeartbeatTimeoutSeconds)*time.Second
+}
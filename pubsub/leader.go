@@ -0,0 +1,91 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"github.com/halilbulentorhon/cb-pubsub/constant"
+	"github.com/halilbulentorhon/cb-pubsub/model"
+)
+
+func (c *cbPubSub[T]) IsLeader() bool {
+	return c.leader.Load()
+}
+
+func (c *cbPubSub[T]) leaseTtl() time.Duration {
+	return time.Duration(c.cfg.CleanupIntervalSeconds) * time.Second * constant.LeaderLeaseTtlMultiplier
+}
+
+func (c *cbPubSub[T]) campaign(ctx context.Context) (bool, error) {
+	lease := model.LeaseDoc{
+		Holder:    c.instanceId,
+		RenewedAt: time.Now().Unix(),
+	}
+
+	_, err := c.repository.Insert(ctx, constant.LeaderLeaseDocName, lease, c.leaseTtl())
+	if err == nil {
+		c.setLeader(true)
+		return true, nil
+	}
+	if !errors.Is(err, gocb.ErrDocumentExists) {
+		c.setLeader(false)
+		return false, err
+	}
+
+	var current model.LeaseDoc
+	cas, err := c.repository.Get(ctx, constant.LeaderLeaseDocName, &current)
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		c.setLeader(false)
+		return false, nil
+	} else if err != nil {
+		c.setLeader(false)
+		return false, err
+	}
+
+	if current.Holder != c.instanceId {
+		c.setLeader(false)
+		return false, nil
+	}
+
+	err = c.repository.ReplaceWithCas(ctx, constant.LeaderLeaseDocName, lease, c.leaseTtl(), cas)
+	if errors.Is(err, gocb.ErrCasMismatch) || errors.Is(err, gocb.ErrDocumentNotFound) {
+		c.setLeader(false)
+		return false, nil
+	} else if err != nil {
+		c.setLeader(false)
+		return false, err
+	}
+
+	c.setLeader(true)
+	return true, nil
+}
+
+func (c *cbPubSub[T]) resign(ctx context.Context) {
+	if !c.leader.Swap(false) {
+		return
+	}
+
+	var current model.LeaseDoc
+	cas, err := c.repository.Get(ctx, constant.LeaderLeaseDocName, &current)
+	if err != nil || current.Holder != c.instanceId {
+		return
+	}
+	if err = c.repository.DeleteWithCas(ctx, constant.LeaderLeaseDocName, cas); err != nil {
+		c.logger.Warn("failed to release leader lease", "error", err, "instance_id", c.instanceId)
+		return
+	}
+	c.logger.Info("released leader lease", "instance_id", c.instanceId)
+}
+
+func (c *cbPubSub[T]) setLeader(leader bool) {
+	if c.leader.Swap(leader) == leader {
+		return
+	}
+	if leader {
+		c.logger.Info("acquired leader lease", "instance_id", c.instanceId)
+	} else {
+		c.logger.Info("lost leader lease", "instance_id", c.instanceId)
+	}
+}
@@ -0,0 +1,79 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"github.com/halilbulentorhon/cb-pubsub/constant"
+	"github.com/halilbulentorhon/cb-pubsub/model"
+)
+
+type Member struct {
+	InstanceId string
+	Hostname   string
+	Pod        string
+	Version    string
+	StartedAt  time.Time
+	LastSeen   time.Time
+	Paused     bool
+	Filter     string
+	Labels     map[string]string
+}
+
+func (c *cbPubSub[T]) Members(ctx context.Context, channel string) ([]Member, error) {
+	var allDoc model.AssignmentDoc
+	_, err := c.repository.Get(ctx, constant.AssignmentDocName, &allDoc)
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get assignment document: %w", err)
+	}
+
+	now := time.Now()
+	members := make([]Member, 0, len(allDoc[channel]))
+	for instanceId, entry := range allDoc[channel] {
+		if c.isExpired(entry.Timestamp, now) {
+			continue
+		}
+		members = append(members, newMember(instanceId, entry))
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].InstanceId < members[j].InstanceId
+	})
+	return members, nil
+}
+
+func newMember(instanceId string, entry model.AssignmentEntry) Member {
+	member := Member{
+		InstanceId: instanceId,
+		Hostname:   entry.Hostname,
+		Pod:        entry.Pod,
+		Version:    entry.Version,
+		LastSeen:   time.Unix(entry.Timestamp, 0),
+		Paused:     entry.Paused,
+		Filter:     entry.Filter,
+		Labels:     entry.Labels,
+	}
+	if entry.StartedAt > 0 {
+		member.StartedAt = time.Unix(entry.StartedAt, 0)
+	}
+	return member
+}
+
+func newMemberMetadata(o options) model.MemberMetadata {
+	hostname, _ := os.Hostname()
+	return model.MemberMetadata{
+		Hostname:  hostname,
+		Pod:       os.Getenv(constant.PodNameEnv),
+		Version:   o.version,
+		StartedAt: time.Now().Unix(),
+		Labels:    maps.Clone(o.labels),
+	}
+}
@@ -0,0 +1,144 @@
+package pubsub
+
+import (
+	"context"
+	"time"
+
+	"github.com/halilbulentorhon/cb-pubsub/constant"
+	"github.com/halilbulentorhon/cb-pubsub/model"
+)
+
+type MembershipReason int
+
+const (
+	MembershipJoined MembershipReason = iota
+	MembershipLeft
+	MembershipExpired
+	MembershipCleanedUp
+)
+
+func (r MembershipReason) String() string {
+	switch r {
+	case MembershipJoined:
+		return "joined"
+	case MembershipLeft:
+		return "left"
+	case MembershipExpired:
+		return "expired"
+	case MembershipCleanedUp:
+		return "cleaned-up"
+	default:
+		return "unknown"
+	}
+}
+
+type MembershipEvent struct {
+	Channel string
+	Member  Member
+	Reason  MembershipReason
+}
+
+type knownMember struct {
+	entry   model.AssignmentEntry
+	expired bool
+}
+
+func (c *cbPubSub[T]) OnMembershipChange(hook func(MembershipEvent)) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	c.membershipHooks = append(c.membershipHooks, hook)
+}
+
+func (c *cbPubSub[T]) hasMembershipHooks() bool {
+	c.hooksMu.RLock()
+	defer c.hooksMu.RUnlock()
+	return len(c.membershipHooks) > 0
+}
+
+func (c *cbPubSub[T]) watchMembers(ctx context.Context) error {
+	if !c.hasMembershipHooks() {
+		return nil
+	}
+
+	var allDoc model.AssignmentDoc
+	_, err := c.repository.Get(ctx, constant.AssignmentDocName, &allDoc)
+	if err != nil {
+		return err
+	}
+	c.observeMembers(allDoc, time.Now())
+	return nil
+}
+
+func (c *cbPubSub[T]) observeMembers(allDoc model.AssignmentDoc, now time.Time) {
+	if !c.hasMembershipHooks() {
+		return
+	}
+
+	c.membershipMu.Lock()
+	defer c.membershipMu.Unlock()
+
+	first := c.knownMembers == nil
+	var events []MembershipEvent
+	current := make(map[string]knownMember, len(allDoc[c.channel]))
+	for memberId, entry := range allDoc[c.channel] {
+		if memberId == c.instanceId {
+			continue
+		}
+
+		expired := c.isExpired(entry.Timestamp, now)
+		prev, seen := c.knownMembers[memberId]
+		if !expired && (!seen || prev.expired) {
+			events = append(events, c.membershipEvent(memberId, entry, MembershipJoined))
+		} else if expired && seen && !prev.expired {
+			events = append(events, c.membershipEvent(memberId, entry, MembershipExpired))
+		}
+		current[memberId] = knownMember{entry: entry, expired: expired}
+	}
+
+	for memberId, prev := range c.knownMembers {
+		if _, found := current[memberId]; found {
+			continue
+		}
+		reason := MembershipLeft
+		if c.isExpired(prev.entry.Timestamp, now) {
+			reason = MembershipCleanedUp
+		}
+		events = append(events, c.membershipEvent(memberId, prev.entry, reason))
+	}
+	c.knownMembers = current
+	if first {
+		return
+	}
+
+	c.hooksMu.RLock()
+	hooks := c.membershipHooks
+	c.hooksMu.RUnlock()
+
+	for _, event := range events {
+		c.logger.Debug("membership changed", "member_id", event.Member.InstanceId, "reason", event.Reason.String(), "instance_id", c.instanceId)
+		for _, hook := range hooks {
+			hook(event)
+		}
+	}
+}
+
+func (c *cbPubSub[T]) membershipEvent(memberId string, entry model.AssignmentEntry, reason MembershipReason) MembershipEvent {
+	return MembershipEvent{
+		Channel: c.channel,
+		Member:  newMember(memberId, entry),
+		Reason:  reason,
+	}
+}
+
+func (c *cbPubSub[T]) withoutExpired(allDoc model.AssignmentDoc, now time.Time) model.AssignmentDoc {
+	live := make(model.AssignmentDoc, len(allDoc))
+	for channel, memberMap := range allDoc {
+		live[channel] = make(map[string]model.AssignmentEntry, len(memberMap))
+		for memberId, entry := range memberMap {
+			if !c.isExpired(entry.Timestamp, now) {
+				live[channel][memberId] = entry
+			}
+		}
+	}
+	return live
+}
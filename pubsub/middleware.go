@@ -0,0 +1,81 @@
+package pubsub
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	util "github.com/halilbulentorhon/cb-pubsub/pkg"
+)
+
+type Middleware[T any] func(next PubSubHandler[T]) PubSubHandler[T]
+
+type PublishFunc[T any] func(ctx context.Context, msg T, headers map[string]string) error
+
+type PublishInterceptor[T any] func(next PublishFunc[T]) PublishFunc[T]
+
+func Chain[T any](handler PubSubHandler[T], middlewares ...Middleware[T]) PubSubHandler[T] {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+func ChainPublish[T any](publish PublishFunc[T], interceptors ...PublishInterceptor[T]) PublishFunc[T] {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		publish = interceptors[i](publish)
+	}
+	return publish
+}
+
+func Recovery[T any]() Middleware[T] {
+	return func(next PubSubHandler[T]) PubSubHandler[T] {
+		return func(ctx context.Context, messages []T) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}()
+			return next(ctx, messages)
+		}
+	}
+}
+
+func Logging[T any](logger util.Logger) Middleware[T] {
+	return func(next PubSubHandler[T]) PubSubHandler[T] {
+		return func(ctx context.Context, messages []T) error {
+			start := time.Now()
+			err := next(ctx, messages)
+			if err != nil {
+				logger.Warn("handler failed", "error", err, "message_count", len(messages), "duration", time.Since(start))
+				return err
+			}
+			logger.Info("handler completed", "message_count", len(messages), "duration", time.Since(start))
+			return nil
+		}
+	}
+}
+
+func (c *cbPubSub[T]) Use(middlewares ...Middleware[T]) {
+	c.chainMu.Lock()
+	defer c.chainMu.Unlock()
+	c.middlewares = append(c.middlewares, middlewares...)
+}
+
+func (c *cbPubSub[T]) UsePublish(interceptors ...PublishInterceptor[T]) {
+	c.chainMu.Lock()
+	defer c.chainMu.Unlock()
+	c.interceptors = append(c.interceptors, interceptors...)
+}
+
+func (c *cbPubSub[T]) wrapHandler(handler PubSubHandler[T]) PubSubHandler[T] {
+	c.chainMu.RLock()
+	defer c.chainMu.RUnlock()
+	return Chain(handler, c.middlewares...)
+}
+
+func (c *cbPubSub[T]) wrapPublish(publish PublishFunc[T]) PublishFunc[T] {
+	c.chainMu.RLock()
+	defer c.chainMu.RUnlock()
+	return ChainPublish(publish, c.interceptors...)
+}
@@ -0,0 +1,119 @@
+package pubsub
+
+import (
+	"context"
+
+	"github.com/halilbulentorhon/cb-pubsub/codec"
+	"github.com/halilbulentorhon/cb-pubsub/model"
+	"github.com/halilbulentorhon/cb-pubsub/notifier"
+)
+
+type DeadLetterHandler func(ctx context.Context, msg model.Message, cause error)
+
+type Option func(*options)
+
+type options struct {
+	codec       codec.Codec
+	keyProvider KeyProvider
+	deadLetter  DeadLetterHandler
+	signing     *SigningConfig
+	orderingKey any
+	notifier    notifier.ChangeNotifier
+	version     string
+	labels      map[string]string
+	lifecycle   context.Context
+}
+
+func WithCodec(c codec.Codec) Option {
+	return func(o *options) {
+		o.codec = c
+	}
+}
+
+func WithEncryption(keyProvider KeyProvider) Option {
+	return func(o *options) {
+		o.keyProvider = keyProvider
+	}
+}
+
+func WithSigning(cfg SigningConfig) Option {
+	return func(o *options) {
+		o.signing = &cfg
+	}
+}
+
+func WithOrderingKey[T any](key func(msg T) string) Option {
+	return func(o *options) {
+		o.orderingKey = key
+	}
+}
+
+func WithChangeNotifier(n notifier.ChangeNotifier) Option {
+	return func(o *options) {
+		o.notifier = n
+	}
+}
+
+func WithVersion(version string) Option {
+	return func(o *options) {
+		o.version = version
+	}
+}
+
+func WithLabels(labels map[string]string) Option {
+	return func(o *options) {
+		o.labels = labels
+	}
+}
+
+func WithLifecycleContext(ctx context.Context) Option {
+	return func(o *options) {
+		if ctx != nil {
+			o.lifecycle = ctx
+		}
+	}
+}
+
+func WithDeadLetterHandler(handler DeadLetterHandler) Option {
+	return func(o *options) {
+		o.deadLetter = handler
+	}
+}
+
+func applyOptions(opts []Option) options {
+	o := options{
+		codec:     codec.JSON{},
+		lifecycle: context.Background(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+type PublishOption func(*publishOptions)
+
+type publishOptions struct {
+	headers     map[string]string
+	onSaturated func(members []string)
+}
+
+func WithHeaders(headers map[string]string) PublishOption {
+	return func(o *publishOptions) {
+		o.headers = headers
+	}
+}
+
+func WithSaturatedMembers(fn func(members []string)) PublishOption {
+	return func(o *publishOptions) {
+		o.onSaturated = fn
+	}
+}
+
+func applyPublishOptions(opts []PublishOption) publishOptions {
+	var o publishOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,80 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/halilbulentorhon/cb-pubsub/constant"
+	"github.com/halilbulentorhon/cb-pubsub/model"
+	util "github.com/halilbulentorhon/cb-pubsub/pkg"
+)
+
+var ErrBlobUnavailable = errors.New("overflow blob unavailable")
+
+func (c *cbPubSub[T]) offload(ctx context.Context, envelope *model.Message) error {
+	if c.cfg.OverflowThresholdBytes <= 0 || len(envelope.Payload) < c.cfg.OverflowThresholdBytes {
+		return nil
+	}
+	return c.storeBlob(ctx, envelope)
+}
+
+func (c *cbPubSub[T]) storeBlob(ctx context.Context, envelope *model.Message) error {
+	if envelope.Blob != nil {
+		return nil
+	}
+
+	payload := envelope.Payload
+	blobTTL := time.Duration(c.cfg.OverflowTtlSeconds) * time.Second
+	ref := &model.BlobRef{
+		Id:   uuid.NewString(),
+		Size: len(payload),
+	}
+
+	for start := 0; start < len(payload); start += c.cfg.OverflowChunkBytes {
+		end := min(start+c.cfg.OverflowChunkBytes, len(payload))
+		key := blobDocId(ref.Id, ref.Chunks)
+		err := c.repository.Upsert(ctx, key, model.BlobDoc{Data: payload[start:end]}, blobTTL)
+		if err != nil {
+			return fmt.Errorf("failed to store overflow chunk %d of blob %s: %w", ref.Chunks, ref.Id, err)
+		}
+		ref.Chunks++
+	}
+
+	envelope.Blob = ref
+	envelope.Payload = nil
+	return nil
+}
+
+func (c *cbPubSub[T]) restore(ctx context.Context, envelope *model.Message) error {
+	if envelope.Blob == nil {
+		return nil
+	}
+
+	payload := make([]byte, 0, envelope.Blob.Size)
+	for i := 0; i < envelope.Blob.Chunks; i++ {
+		var blob model.BlobDoc
+		key := blobDocId(envelope.Blob.Id, i)
+		err := util.WithRetry(ctx, c.subscribeRetryConfig, func() error {
+			_, err := c.repository.Get(ctx, key, &blob)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("%w: chunk %d of blob %s: %w", ErrBlobUnavailable, i, envelope.Blob.Id, err)
+		}
+		payload = append(payload, blob.Data...)
+	}
+
+	if len(payload) != envelope.Blob.Size {
+		return fmt.Errorf("%w: blob %s has %d bytes, want %d", ErrBlobUnavailable, envelope.Blob.Id, len(payload), envelope.Blob.Size)
+	}
+
+	envelope.Payload = payload
+	return nil
+}
+
+func blobDocId(blobId string, chunk int) string {
+	return fmt.Sprintf("%s%s_%d", constant.BlobDocPrefix, blobId, chunk)
+}
@@ -0,0 +1,173 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/couchbase/gocb/v2"
+	"github.com/halilbulentorhon/cb-pubsub/constant"
+	"github.com/halilbulentorhon/cb-pubsub/model"
+	util "github.com/halilbulentorhon/cb-pubsub/pkg"
+	"github.com/halilbulentorhon/cb-pubsub/repository"
+)
+
+func (c *cbPubSub[T]) poll(ctx context.Context) (bool, error) {
+	c.pollMu.Lock()
+	defer c.pollMu.Unlock()
+
+	if c.paused.Load() {
+		return false, c.touchSelfDoc(ctx)
+	}
+	return c.receive(ctx)
+}
+
+func (c *cbPubSub[T]) receive(ctx context.Context) (bool, error) {
+	if c.cfg.MaxBatchSize > 0 {
+		return c.pollBatches(ctx)
+	}
+
+	var selfDoc model.PubSubDoc[model.Message]
+
+	err := util.WithRetry(ctx, c.subscribeRetryConfig, func() error {
+		_, err := c.repository.GetAndTouch(ctx, c.selfDocId, &selfDoc, c.selfDocTtl())
+		if errors.Is(err, gocb.ErrDocumentNotFound) {
+			c.logger.Info("self document not found, recreating...", "instance_id", c.instanceId, "channel", c.channel)
+			return c.assign(ctx)
+		}
+		return err
+	})
+
+	if err != nil {
+		c.logger.Error("failed to get self document after retries, shutting down", "error", err, "instance_id", c.instanceId, "channel", c.channel)
+		return false, fmt.Errorf("subscribe failed after retries: %w", err)
+	}
+
+	if len(selfDoc.Messages) == 0 {
+		return false, nil
+	}
+
+	c.processBatch(ctx, selfDoc.Messages, selfDoc.HeadSeq)
+	return true, nil
+}
+
+func (c *cbPubSub[T]) touchSelfDoc(ctx context.Context) error {
+
+	err := util.WithRetry(ctx, c.subscribeRetryConfig, func() error {
+		err := c.repository.Touch(ctx, c.selfDocId, c.selfDocTtl())
+		if errors.Is(err, gocb.ErrDocumentNotFound) {
+			c.logger.Info("self document not found, recreating...", "instance_id", c.instanceId, "channel", c.channel)
+			return c.assign(ctx)
+		}
+		return err
+	})
+
+	if err != nil {
+		c.logger.Error("failed to touch self document after retries, shutting down", "error", err, "instance_id", c.instanceId, "channel", c.channel)
+		return fmt.Errorf("subscribe failed after retries: %w", err)
+	}
+	return nil
+}
+
+func (c *cbPubSub[T]) pollBatches(ctx context.Context) (bool, error) {
+	err := c.touchSelfDoc(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	received := false
+	for ctx.Err() == nil && !c.shutdownMgr.IsClosed() {
+		c.markPollActivity()
+		var items []json.RawMessage
+		var state repository.ArrayState
+		err = util.WithRetry(ctx, c.subscribeRetryConfig, func() error {
+			var err error
+			items, state, err = c.repository.ArrayGetRange(ctx, c.selfDocId, constant.MessagesPath, constant.HeadSeqPath, 0, c.cfg.MaxBatchSize-1)
+			return err
+		})
+		if err != nil {
+			c.logger.Error("failed to fetch message batch after retries, shutting down", "error", err, "instance_id", c.instanceId, "channel", c.channel)
+			return received, fmt.Errorf("subscribe failed after retries: %w", err)
+		}
+
+		if len(items) == 0 {
+			return received, nil
+		}
+		received = true
+
+		envelopes := make([]model.Message, len(items))
+		for i, item := range items {
+			if err = json.Unmarshal(item, &envelopes[i]); err != nil {
+				c.logger.Error("failed to unmarshal message envelope", "error", err, "index", i, "instance_id", c.instanceId)
+			}
+		}
+
+		if !c.processBatch(ctx, envelopes, state.Seq) || state.Count <= len(items) {
+			return received, nil
+		}
+	}
+
+	return received, nil
+}
+
+func (c *cbPubSub[T]) processBatch(ctx context.Context, envelopes []model.Message, seq int64) bool {
+	subs := c.activeSubscriptions()
+	if len(subs) == 0 {
+		return false
+	}
+
+	messages, positions := c.decodeAll(ctx, envelopes)
+	completed := c.fanOut(envelopes, subs, messages, positions)
+	if completed == 0 {
+		return false
+	}
+
+	removeCtx := context.WithoutCancel(ctx)
+	err := util.WithRetry(removeCtx, c.subscribeRetryConfig, func() error {
+		return c.ack(removeCtx, seq+int64(completed))
+	})
+	if err != nil {
+		c.logger.Error("failed to remove processed messages after retries", "error", err, "message_count", completed, "instance_id", c.instanceId)
+		return false
+	}
+
+	for _, sub := range subs {
+		sub.offset -= completed
+	}
+
+	return completed == len(envelopes)
+}
+
+func (c *cbPubSub[T]) ack(ctx context.Context, through int64) error {
+	return c.removeHead(ctx, c.selfDocId, func(state repository.ArrayState) int64 {
+		return min(through-state.Seq, int64(state.Count))
+	})
+}
+
+func (c *cbPubSub[T]) removeHead(ctx context.Context, docId string, excess func(repository.ArrayState) int64) error {
+	for mismatches := 0; mismatches < constant.MaxCasAttempts; {
+		state, err := c.repository.ArrayHeadState(ctx, docId, constant.MessagesPath, constant.HeadSeqPath)
+		if errors.Is(err, gocb.ErrDocumentNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		remaining := excess(state)
+		if remaining <= 0 {
+			return nil
+		}
+
+		chunk := min(remaining, constant.MaxSubDocSpecs-1)
+		err = c.repository.ArrayRemoveHead(ctx, docId, constant.MessagesPath, constant.HeadSeqPath, int(chunk), state.Cas)
+		if errors.Is(err, gocb.ErrCasMismatch) {
+			mismatches++
+		} else if err != nil {
+			return err
+		} else if chunk == remaining {
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to remove head of %s: %w", docId, gocb.ErrCasMismatch)
+}
@@ -3,9 +3,28 @@ package pubsub
 import "context"
 
 type PubSub[T any] interface {
-	Publish(ctx context.Context, msg T) error
+	Publish(ctx context.Context, msg T, opts ...PublishOption) error
 	Subscribe(ctx context.Context, handler PubSubHandler[T]) error
-	Close() error
+	Messages(ctx context.Context) <-chan Delivery[T]
+	Err() error
+	SetFilter(ctx context.Context, expr string) error
+	Pause(ctx context.Context) error
+	Resume(ctx context.Context) error
+	IsPaused() bool
+	IsLeader() bool
+	Reconcile(ctx context.Context) (ReconcileReport, error)
+	Members(ctx context.Context, channel string) ([]Member, error)
+	OnMembershipChange(hook func(MembershipEvent))
+	Use(middlewares ...Middleware[T])
+	UsePublish(interceptors ...PublishInterceptor[T])
+	Stats() Stats
+	Drain(ctx context.Context) error
+	Close(ctx context.Context) error
 }
 
-type PubSubHandler[T any] func(messages []T) error
+type PubSubHandler[T any] func(ctx context.Context, messages []T) error
+
+type Stats struct {
+	RejectedMessages    uint64
+	SaturatedDeliveries uint64
+}
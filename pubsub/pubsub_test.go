@@ -2,25 +2,43 @@ package pubsub
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/couchbase/gocb/v2"
+	"github.com/halilbulentorhon/cb-pubsub/codec"
 	"github.com/halilbulentorhon/cb-pubsub/config"
 	"github.com/halilbulentorhon/cb-pubsub/constant"
 	"github.com/halilbulentorhon/cb-pubsub/mocks"
 	"github.com/halilbulentorhon/cb-pubsub/model"
+	"github.com/halilbulentorhon/cb-pubsub/notifier"
 	util "github.com/halilbulentorhon/cb-pubsub/pkg"
+	"github.com/halilbulentorhon/cb-pubsub/repository"
 	"go.uber.org/mock/gomock"
 )
 
 func createTestCbPubSub(t *testing.T, mockRepo *mocks.MockRepository) *cbPubSub[string] {
 	cfg := config.PubSubConfig{
-		PollIntervalSeconds:    1,
-		CleanupIntervalSeconds: 15,
-		SubscribeRetryAttempts: 3,
-		CleanupRetryAttempts:   5,
+		PollIntervalSeconds:      1,
+		MinPollInterval:          time.Second,
+		MaxPollInterval:          time.Second,
+		CleanupIntervalSeconds:   15,
+		SubscribeRetryAttempts:   3,
+		CleanupRetryAttempts:     5,
+		HandlerTimeoutSec:        30,
+		HeartbeatIntervalSeconds: 10,
+		HeartbeatTimeoutSeconds:  30,
+		SelfDocTtlSeconds:        600,
+		MaxConsecutiveFailures:   10,
+		CleanupBackoffMultiplier: 1.5,
+		MaxCleanupInterval:       5 * time.Minute,
 	}
 
 	logger := util.NewDevLogger("test")
@@ -28,10 +46,11 @@ func createTestCbPubSub(t *testing.T, mockRepo *mocks.MockRepository) *cbPubSub[
 	return &cbPubSub[string]{
 		cfg:         cfg,
 		repository:  mockRepo,
+		codec:       codec.JSON{},
 		channel:     "test-channel",
 		instanceId:  "test-instance",
 		selfDocId:   constant.SelfDocPrefix + "test-instance",
-		shutdownMgr: newShutdownManager(logger.With("component", "shutdown-manager")),
+		shutdownMgr: newShutdownManager(logger.With("component", "shutdown-manager"), constant.DefaultShutdownTimeout),
 		logger:      logger,
 		subscribeRetryConfig: util.RetryConfig{
 			MaxRetries:   3,
@@ -48,6 +67,14 @@ func createTestCbPubSub(t *testing.T, mockRepo *mocks.MockRepository) *cbPubSub[
 	}
 }
 
+func testEnvelope(t *testing.T, msg string, headers map[string]string) model.Message {
+	payload, err := codec.JSON{}.Marshal(msg)
+	if err != nil {
+		t.Fatalf("failed to marshal test message: %v", err)
+	}
+	return model.Message{Headers: headers, Codec: codec.JSONName, Payload: payload}
+}
+
 func TestCbPubSub_Publish_Success(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -57,8 +84,8 @@ func TestCbPubSub_Publish_Success(t *testing.T) {
 
 	assignmentDoc := model.AssignmentDoc{
 		"test-channel": {
-			"instance1": 1234567890,
-			"instance2": 1234567891,
+			"instance1": {Timestamp: 1234567890},
+			"instance2": {Timestamp: 1234567891},
 		},
 	}
 
@@ -70,11 +97,11 @@ func TestCbPubSub_Publish_Success(t *testing.T) {
 		})
 
 	mockRepo.EXPECT().
-		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"instance1", constant.MessagesPath, "test-message").
+		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"instance1", constant.MessagesPath, testEnvelope(t, "test-message", nil)).
 		Return(nil)
 
 	mockRepo.EXPECT().
-		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"instance2", constant.MessagesPath, "test-message").
+		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"instance2", constant.MessagesPath, testEnvelope(t, "test-message", nil)).
 		Return(nil)
 
 	err := pubsub.Publish(context.Background(), "test-message")
@@ -92,7 +119,7 @@ func TestCbPubSub_Publish_channelNotFound(t *testing.T) {
 
 	assignmentDoc := model.AssignmentDoc{
 		"other-channel": {
-			"instance1": 1234567890,
+			"instance1": {Timestamp: 1234567890},
 		},
 	}
 
@@ -121,8 +148,8 @@ func TestCbPubSub_Publish_DocumentNotFound(t *testing.T) {
 
 	assignmentDoc := model.AssignmentDoc{
 		"test-channel": {
-			"instance1": 1234567890,
-			"instance2": 1234567891,
+			"instance1": {Timestamp: 1234567890},
+			"instance2": {Timestamp: 1234567891},
 		},
 	}
 
@@ -134,11 +161,11 @@ func TestCbPubSub_Publish_DocumentNotFound(t *testing.T) {
 		})
 
 	mockRepo.EXPECT().
-		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"instance1", constant.MessagesPath, "test-message").
+		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"instance1", constant.MessagesPath, testEnvelope(t, "test-message", nil)).
 		Return(gocb.ErrDocumentNotFound)
 
 	mockRepo.EXPECT().
-		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"instance2", constant.MessagesPath, "test-message").
+		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"instance2", constant.MessagesPath, testEnvelope(t, "test-message", nil)).
 		Return(nil)
 
 	err := pubsub.Publish(context.Background(), "test-message")
@@ -154,13 +181,14 @@ func TestCbPubSub_PerformCleanup_Success(t *testing.T) {
 	mockRepo := mocks.NewMockRepository(ctrl)
 	pubsub := createTestCbPubSub(t, mockRepo)
 
+	now := time.Now().Unix()
 	assignmentDoc := model.AssignmentDoc{
 		"test-channel": {
-			"active-instance":   1234567890,
-			"inactive-instance": 1234567891,
+			"active-instance":   {Timestamp: now},
+			"inactive-instance": {Timestamp: now - 31},
 		},
 		"other-channel": {
-			"another-inactive": 1234567892,
+			"another-inactive": {Timestamp: 1234567892},
 		},
 	}
 
@@ -171,18 +199,6 @@ func TestCbPubSub_PerformCleanup_Success(t *testing.T) {
 			return gocb.Cas(123), nil
 		})
 
-	mockRepo.EXPECT().
-		Get(gomock.Any(), constant.SelfDocPrefix+"active-instance", gomock.Any()).
-		Return(gocb.Cas(456), nil)
-
-	mockRepo.EXPECT().
-		Get(gomock.Any(), constant.SelfDocPrefix+"inactive-instance", gomock.Any()).
-		Return(gocb.Cas(0), gocb.ErrDocumentNotFound)
-
-	mockRepo.EXPECT().
-		Get(gomock.Any(), constant.SelfDocPrefix+"another-inactive", gomock.Any()).
-		Return(gocb.Cas(0), gocb.ErrDocumentNotFound)
-
 	mockRepo.EXPECT().
 		RemoveMultiplePaths(gomock.Any(), constant.AssignmentDocName, gomock.Any()).
 		DoAndReturn(func(ctx context.Context, key string, paths []string) error {
@@ -217,10 +233,193 @@ func TestCbPubSub_PerformCleanup_NoInactiveMembers(t *testing.T) {
 	mockRepo := mocks.NewMockRepository(ctrl)
 	pubsub := createTestCbPubSub(t, mockRepo)
 
+	now := time.Now().Unix()
+	assignmentDoc := model.AssignmentDoc{
+		"test-channel": {
+			"instance1": {Timestamp: now},
+			"instance2": {Timestamp: now - 29},
+		},
+	}
+
+	mockRepo.EXPECT().
+		Get(gomock.Any(), constant.AssignmentDocName, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}) (gocb.Cas, error) {
+			*(result.(*model.AssignmentDoc)) = assignmentDoc
+			return gocb.Cas(123), nil
+		})
+
+	err := pubsub.performCleanup(context.Background())
+	if err != nil {
+		t.Errorf("performCleanup returned error: %v", err)
+	}
+}
+
+func TestCbPubSub_Beat(t *testing.T) {
+	tests := []struct {
+		name      string
+		upsertErr error
+		reassign  bool
+		wantErr   bool
+	}{
+		{name: "refreshes timestamp"},
+		{name: "re-registers missing entry", upsertErr: gocb.ErrPathNotFound, reassign: true},
+		{name: "re-registers missing document", upsertErr: gocb.ErrDocumentNotFound, reassign: true},
+		{name: "returns other errors", upsertErr: errors.New("timeout"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			pubsub := createTestCbPubSub(t, mockRepo)
+
+			expectedPath := util.GetAssignmentFieldPath(pubsub.channel, pubsub.instanceId, constant.TimestampField)
+			mockRepo.EXPECT().
+				UpsertPath(gomock.Any(), constant.AssignmentDocName, expectedPath, gomock.Any()).
+				DoAndReturn(func(ctx context.Context, key string, path string, value interface{}) error {
+					if ts, ok := value.(int64); !ok || time.Now().Unix()-ts > 1 {
+						t.Errorf("heartbeat value = %v, want current unix time", value)
+					}
+					return tt.upsertErr
+				})
+
+			if tt.reassign {
+				mockRepo.EXPECT().
+					UpsertPath(gomock.Any(), constant.AssignmentDocName, util.GetAssignmentPath(pubsub.channel, pubsub.instanceId), gomock.Any()).
+					Return(nil)
+			}
+
+			err := pubsub.beat(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("beat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCbPubSub_Subscribe_RefreshesHeartbeatDuringLongHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.HeartbeatIntervalSeconds = 1
+	pubsub.cfg.HeartbeatTimeoutSeconds = 2
+	pubsub.cfg.MinPollInterval = 10 * time.Millisecond
+	pubsub.cfg.MaxPollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wantBeats := pubsub.cfg.HeartbeatTimeoutSeconds + 1
+	beats := make(chan struct{}, 16)
+	expectedPath := util.GetAssignmentFieldPath(pubsub.channel, pubsub.instanceId, constant.TimestampField)
+	mockRepo.EXPECT().
+		UpsertPath(gomock.Any(), constant.AssignmentDocName, expectedPath, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, path string, value interface{}) error {
+			beats <- struct{}{}
+			return nil
+		}).
+		MinTimes(wantBeats)
+
+	gomock.InOrder(
+		mockRepo.EXPECT().
+			GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
+				doc := result.(*model.PubSubDoc[model.Message])
+				doc.Messages = []model.Message{testEnvelope(t, "slow", nil)}
+				return gocb.Cas(1), nil
+			}),
+		expectAck(mockRepo, pubsub.selfDocId, 0, 1).Return(nil),
+	)
+	mockRepo.EXPECT().
+		GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+		Return(gocb.Cas(2), nil).
+		AnyTimes()
+
+	go pubsub.heartbeat()
+
+	started := time.Now()
+	err := pubsub.Subscribe(ctx, func(ctx context.Context, messages []string) error {
+		defer cancel()
+		for i := 0; i < wantBeats; i++ {
+			select {
+			case <-beats:
+			case <-time.After(5 * time.Second):
+				t.Errorf("heartbeats during handler = %d, want %d", i, wantBeats)
+				return nil
+			}
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Subscribe error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(started); elapsed <= time.Duration(pubsub.cfg.HeartbeatTimeoutSeconds)*time.Second {
+		t.Errorf("handler ran for %v, want longer than the heartbeat timeout", elapsed)
+	}
+
+	pubsub.subsMu.Lock()
+	loop := pubsub.loop
+	pubsub.subsMu.Unlock()
+	_ = pubsub.shutdownMgr.Shutdown(context.Background(), func(context.Context) error { return nil })
+	if loop != nil {
+		<-loop.done
+	}
+}
+
+func TestCbPubSub_PollLoopAlive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pubsub := createTestCbPubSub(t, mocks.NewMockRepository(ctrl))
+	now := time.Now()
+	stall := time.Duration(pubsub.cfg.HandlerTimeoutSec+pubsub.cfg.HeartbeatIntervalSeconds)*time.Second + pubsub.cfg.MaxPollInterval
+
+	tests := []struct {
+		name     string
+		running  bool
+		activity time.Time
+		want     bool
+	}{
+		{name: "no poll loop", running: false, activity: now, want: false},
+		{name: "recent activity", running: true, activity: now.Add(-time.Second), want: true},
+		{name: "handler within timeout", running: true, activity: now.Add(-stall), want: true},
+		{name: "stalled loop", running: true, activity: now.Add(-stall - time.Second), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pubsub.loop = nil
+			if tt.running {
+				pubsub.loop = &pollLoop{}
+			}
+			pubsub.pollActivity.Store(tt.activity.UnixNano())
+
+			if got := pubsub.pollLoopAlive(now); got != tt.want {
+				t.Errorf("pollLoopAlive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCbPubSub_Reconcile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	now := time.Now().Unix()
 	assignmentDoc := model.AssignmentDoc{
 		"test-channel": {
-			"instance1": 1234567890,
-			"instance2": 1234567891,
+			"test-instance":  {Timestamp: now},
+			"healthy":        {Timestamp: now},
+			"missing-doc":    {Timestamp: now},
+			"expired":        {Timestamp: now - 60},
+			"expired-no-doc": {Timestamp: now - 60},
 		},
 	}
 
@@ -231,17 +430,76 @@ func TestCbPubSub_PerformCleanup_NoInactiveMembers(t *testing.T) {
 			return gocb.Cas(123), nil
 		})
 
+	mockRepo.EXPECT().Exists(gomock.Any(), pubsub.selfDocId).Return(true, nil)
+	mockRepo.EXPECT().Exists(gomock.Any(), constant.SelfDocPrefix+"healthy").Return(true, nil)
+	mockRepo.EXPECT().Exists(gomock.Any(), constant.SelfDocPrefix+"missing-doc").Return(false, nil)
+	mockRepo.EXPECT().
+		RemoveMultiplePaths(gomock.Any(), constant.AssignmentDocName, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, paths []string) error {
+			if len(paths) != 3 {
+				t.Errorf("len(paths) = %d, want 3", len(paths))
+			}
+			return nil
+		})
+
+	report, err := pubsub.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if len(report.RemovedEntries) != 2 {
+		t.Errorf("RemovedEntries = %v, want 2 entries", report.RemovedEntries)
+	}
+	orphanedPath := util.GetAssignmentPath(pubsub.channel, "missing-doc")
+	if len(report.OrphanedEntries) != 1 || report.OrphanedEntries[0] != orphanedPath {
+		t.Errorf("OrphanedEntries = %v, want [%s]", report.OrphanedEntries, orphanedPath)
+	}
+	if len(report.RestoredEntries) != 0 {
+		t.Errorf("RestoredEntries = %v, want none", report.RestoredEntries)
+	}
+	if report.Total() != 3 {
+		t.Errorf("Total() = %d, want 3", report.Total())
+	}
+}
+
+func TestCbPubSub_Reconcile_RestoresOwnEntry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
 	mockRepo.EXPECT().
-		Get(gomock.Any(), constant.SelfDocPrefix+"instance1", gomock.Any()).
-		Return(gocb.Cas(456), nil)
+		Get(gomock.Any(), constant.AssignmentDocName, gomock.Any()).
+		Return(gocb.Cas(0), gocb.ErrDocumentNotFound)
 
+	expectedPath := util.GetAssignmentPath(pubsub.channel, pubsub.instanceId)
 	mockRepo.EXPECT().
-		Get(gomock.Any(), constant.SelfDocPrefix+"instance2", gomock.Any()).
-		Return(gocb.Cas(789), nil)
+		UpsertPath(gomock.Any(), constant.AssignmentDocName, expectedPath, gomock.Any()).
+		Return(nil)
 
-	err := pubsub.performCleanup(context.Background())
+	report, err := pubsub.Reconcile(context.Background())
 	if err != nil {
-		t.Errorf("performCleanup returned error: %v", err)
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if len(report.RestoredEntries) != 1 || report.RestoredEntries[0] != expectedPath {
+		t.Errorf("RestoredEntries = %v, want [%s]", report.RestoredEntries, expectedPath)
+	}
+}
+
+func TestCbPubSub_Reconcile_GetError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	mockRepo.EXPECT().
+		Get(gomock.Any(), constant.AssignmentDocName, gomock.Any()).
+		Return(gocb.Cas(0), errors.New("timeout"))
+
+	_, err := pubsub.Reconcile(context.Background())
+	if err == nil {
+		t.Error("Reconcile should return error when the assignment document cannot be read")
 	}
 }
 
@@ -252,7 +510,7 @@ func TestCbPubSub_Assign_Success(t *testing.T) {
 	mockRepo := mocks.NewMockRepository(ctrl)
 	pubsub := createTestCbPubSub(t, mockRepo)
 
-	expectedTTL := time.Duration(constant.SelfDocTtlSeconds) * time.Second
+	expectedTTL := 600 * time.Second
 	mockRepo.EXPECT().
 		Upsert(gomock.Any(), pubsub.selfDocId, gomock.Any(), expectedTTL).
 		Return(nil)
@@ -268,139 +526,2433 @@ func TestCbPubSub_Assign_Success(t *testing.T) {
 	}
 }
 
-func TestCbPubSub_Close_Success(t *testing.T) {
+func TestCbPubSub_Register_IncludesMetadata(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockRepo := mocks.NewMockRepository(ctrl)
 	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.metadata = newMemberMetadata(applyOptions([]Option{
+		WithVersion("1.4.0"),
+		WithLabels(map[string]string{"zone": "eu-1"}),
+	}))
 
-	mockRepo.EXPECT().Delete(gomock.Any(), pubsub.selfDocId).Return(nil)
-	mockRepo.EXPECT().RemoveMultiplePaths(gomock.Any(), constant.AssignmentDocName, gomock.Any()).Return(nil)
-	mockRepo.EXPECT().Close().Return(nil)
+	mockRepo.EXPECT().
+		UpsertPath(gomock.Any(), constant.AssignmentDocName, util.GetAssignmentPath(pubsub.channel, pubsub.instanceId), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, path string, value interface{}) error {
+			entry := value.(model.AssignmentEntry)
+			if entry.Version != "1.4.0" {
+				t.Errorf("Version = %s, want 1.4.0", entry.Version)
+			}
+			if entry.Labels["zone"] != "eu-1" {
+				t.Errorf("Labels = %v, want zone=eu-1", entry.Labels)
+			}
+			if entry.StartedAt == 0 {
+				t.Error("StartedAt = 0, want instance start time")
+			}
+			if hostname, _ := os.Hostname(); entry.Hostname != hostname {
+				t.Errorf("Hostname = %s, want %s", entry.Hostname, hostname)
+			}
+			return nil
+		})
 
-	err := pubsub.Close()
-	if err != nil {
-		t.Errorf("Close returned error: %v", err)
+	if err := pubsub.register(context.Background()); err != nil {
+		t.Errorf("register returned error: %v", err)
 	}
 }
 
-func TestCbPubSub_Close_RepositoryError(t *testing.T) {
+func TestCbPubSub_Members(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockRepo := mocks.NewMockRepository(ctrl)
 	pubsub := createTestCbPubSub(t, mockRepo)
 
-	expectedErr := errors.New("close error")
-	mockRepo.EXPECT().Delete(gomock.Any(), pubsub.selfDocId).Return(nil)
-	mockRepo.EXPECT().RemoveMultiplePaths(gomock.Any(), constant.AssignmentDocName, gomock.Any()).Return(nil)
-	mockRepo.EXPECT().Close().Return(expectedErr)
-
-	err := pubsub.Close()
-	if err != expectedErr {
-		t.Errorf("Close returned error: %v, want %v", err, expectedErr)
+	now := time.Now().Unix()
+	assignmentDoc := model.AssignmentDoc{
+		"test-channel": {
+			"b-instance": {
+				MemberMetadata: model.MemberMetadata{Hostname: "host-b", Pod: "pod-b", Version: "1.4.0", StartedAt: now - 100},
+				Paused:         true,
+				Timestamp:      now,
+			},
+			"a-instance": {Filter: `tenant == "acme"`, Timestamp: now - 5},
+			"expired":    {Timestamp: now - 60},
+		},
+		"other-channel": {
+			"other-instance": {Timestamp: now},
+		},
 	}
-}
 
-func TestCbPubSub_Close_NilRepository(t *testing.T) {
-	logger := util.NewDevLogger("test")
-	pubsub := &cbPubSub[string]{
-		shutdownMgr: newShutdownManager(logger.With("component", "shutdown-manager")),
-	}
+	mockRepo.EXPECT().
+		Get(gomock.Any(), constant.AssignmentDocName, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}) (gocb.Cas, error) {
+			*(result.(*model.AssignmentDoc)) = assignmentDoc
+			return gocb.Cas(123), nil
+		})
 
-	err := pubsub.Close()
+	members, err := pubsub.Members(context.Background(), "test-channel")
 	if err != nil {
-		t.Errorf("Close with nil repository returned error: %v", err)
+		t.Fatalf("Members returned error: %v", err)
 	}
-}
-
-func TestNewCbPubSub_ConfigDefaults(t *testing.T) {
-	cfg := config.PubSubConfig{
-		CouchbaseConfig: config.CouchbaseConfig{
-			Host:           "couchbase://localhost",
-			Username:       "admin",
-			Password:       "password",
-			BucketName:     "test",
-			ScopeName:      "scope",
-			CollectionName: "collection",
-		},
+	if len(members) != 2 {
+		t.Fatalf("len(members) = %d, want 2", len(members))
 	}
 
-	_, err := NewCbPubSub[string]("test-channel", cfg)
-	if err == nil {
-		t.Error("NewCbPubSub should fail with invalid connection")
+	if members[0].InstanceId != "a-instance" || members[1].InstanceId != "b-instance" {
+		t.Errorf("members = [%s %s], want [a-instance b-instance]", members[0].InstanceId, members[1].InstanceId)
+	}
+	if members[0].Filter != `tenant == "acme"` {
+		t.Errorf("Filter = %s, want %s", members[0].Filter, `tenant == "acme"`)
+	}
+	if !members[0].StartedAt.IsZero() {
+		t.Errorf("StartedAt = %v, want zero for entries without metadata", members[0].StartedAt)
+	}
+	if members[1].Hostname != "host-b" || members[1].Pod != "pod-b" || members[1].Version != "1.4.0" || !members[1].Paused {
+		t.Errorf("member = %+v, want host-b/pod-b/1.4.0 paused", members[1])
+	}
+	if members[1].StartedAt.Unix() != now-100 {
+		t.Errorf("StartedAt = %d, want %d", members[1].StartedAt.Unix(), now-100)
+	}
+	if members[1].LastSeen.Unix() != now {
+		t.Errorf("LastSeen = %d, want %d", members[1].LastSeen.Unix(), now)
 	}
 }
 
-func TestPubSubHandler_Function(t *testing.T) {
-	var handlerCalled bool
-	var receivedMessages []string
+func TestCbPubSub_Members_NoAssignmentDoc(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-	handler := func(messages []string) error {
-		handlerCalled = true
-		receivedMessages = messages
-		return nil
-	}
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
 
-	testMessages := []string{"msg1", "msg2", "msg3"}
-	err := handler(testMessages)
+	mockRepo.EXPECT().
+		Get(gomock.Any(), constant.AssignmentDocName, gomock.Any()).
+		Return(gocb.Cas(0), gocb.ErrDocumentNotFound)
 
+	members, err := pubsub.Members(context.Background(), "test-channel")
 	if err != nil {
-		t.Errorf("Handler returned error: %v", err)
+		t.Errorf("Members returned error: %v", err)
 	}
-	if !handlerCalled {
-		t.Error("Handler was not called")
+	if len(members) != 0 {
+		t.Errorf("len(members) = %d, want 0", len(members))
 	}
-	if len(receivedMessages) != 3 {
-		t.Errorf("Handler received %d messages, want 3", len(receivedMessages))
+}
+
+func TestCbPubSub_ObserveMembers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	var events []MembershipEvent
+	pubsub.OnMembershipChange(func(event MembershipEvent) {
+		events = append(events, event)
+	})
+
+	now := time.Now()
+	fresh := now.Unix()
+	stale := now.Unix() - 60
+
+	steps := []struct {
+		name   string
+		doc    model.AssignmentDoc
+		expect map[string]MembershipReason
+	}{
+		{
+			name: "initial members are seeded without events",
+			doc: model.AssignmentDoc{"test-channel": {
+				"test-instance": {Timestamp: fresh},
+				"leaver":        {Timestamp: fresh},
+				"crasher":       {Timestamp: fresh},
+			}},
+			expect: map[string]MembershipReason{},
+		},
+		{
+			name: "graceful leave and expiry",
+			doc: model.AssignmentDoc{"test-channel": {
+				"test-instance": {Timestamp: fresh},
+				"crasher":       {Timestamp: stale},
+			}},
+			expect: map[string]MembershipReason{"leaver": MembershipLeft, "crasher": MembershipExpired},
+		},
+		{
+			name: "expired member cleaned up and newcomer joins",
+			doc: model.AssignmentDoc{
+				"test-channel":  {"test-instance": {Timestamp: fresh}, "newcomer": {Timestamp: fresh}},
+				"other-channel": {"elsewhere": {Timestamp: fresh}},
+			},
+			expect: map[string]MembershipReason{"crasher": MembershipCleanedUp, "newcomer": MembershipJoined},
+		},
+		{
+			name: "unchanged members emit nothing",
+			doc: model.AssignmentDoc{"test-channel": {
+				"test-instance": {Timestamp: fresh},
+				"newcomer":      {Timestamp: fresh},
+			}},
+			expect: map[string]MembershipReason{},
+		},
 	}
-	for i, msg := range testMessages {
-		if receivedMessages[i] != msg {
-			t.Errorf("Message %d = %s, want %s", i, receivedMessages[i], msg)
+
+	for _, step := range steps {
+		events = nil
+		pubsub.observeMembers(step.doc, now)
+
+		if len(events) != len(step.expect) {
+			t.Errorf("%s: len(events) = %d, want %d", step.name, len(events), len(step.expect))
+		}
+		for _, event := range events {
+			want, found := step.expect[event.Member.InstanceId]
+			if !found || event.Reason != want {
+				t.Errorf("%s: event for %s = %s, want %s", step.name, event.Member.InstanceId, event.Reason, want)
+			}
+			if event.Channel != "test-channel" {
+				t.Errorf("%s: Channel = %s, want test-channel", step.name, event.Channel)
+			}
 		}
 	}
 }
 
-func TestPubSubHandler_Error(t *testing.T) {
-	expectedErr := errors.New("handler error")
-	handler := func(messages []string) error {
-		return expectedErr
-	}
+func TestCbPubSub_WatchMembers_SkipsReadWithoutHooks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-	err := handler([]string{"test"})
-	if err != expectedErr {
-		t.Errorf("Handler returned error: %v, want %v", err, expectedErr)
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	if err := pubsub.watchMembers(context.Background()); err != nil {
+		t.Errorf("watchMembers returned error: %v", err)
 	}
 }
 
-func TestCbPubSub_Publish_SkipSelfInstance(t *testing.T) {
+func TestCbPubSub_Close_Success(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockRepo := mocks.NewMockRepository(ctrl)
 	pubsub := createTestCbPubSub(t, mockRepo)
 
-	assignmentDoc := model.AssignmentDoc{
-		"test-channel": {
-			"test-instance":  1234567890,
-			"other-instance": 1234567891,
-		},
+	mockRepo.EXPECT().Delete(gomock.Any(), pubsub.selfDocId).Return(nil)
+	mockRepo.EXPECT().RemoveMultiplePaths(gomock.Any(), constant.AssignmentDocName, gomock.Any()).Return(nil)
+	mockRepo.EXPECT().Close().Return(nil)
+
+	err := pubsub.Close(context.Background())
+	if err != nil {
+		t.Errorf("Close returned error: %v", err)
 	}
+}
 
-	mockRepo.EXPECT().
-		Get(gomock.Any(), constant.AssignmentDocName, gomock.Any()).
-		DoAndReturn(func(ctx context.Context, key string, result interface{}) (gocb.Cas, error) {
-			*(result.(*model.AssignmentDoc)) = assignmentDoc
-			return gocb.Cas(123), nil
-		})
+func TestCbPubSub_WatchLifecycle_ClosesOnContextDone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-	mockRepo.EXPECT().
-		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"other-instance", constant.MessagesPath, "test-message").
-		Return(nil)
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
 
-	err := pubsub.Publish(context.Background(), "test-message")
-	if err != nil {
-		t.Errorf("Publish returned error: %v", err)
+	mockRepo.EXPECT().Delete(gomock.Any(), pubsub.selfDocId).Return(nil)
+	mockRepo.EXPECT().RemoveMultiplePaths(gomock.Any(), constant.AssignmentDocName, gomock.Any()).Return(nil)
+	mockRepo.EXPECT().Close().Return(nil)
+
+	lifecycle, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pubsub.watchLifecycle(lifecycle)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("watchLifecycle did not return after lifecycle context was cancelled")
+	}
+	if !pubsub.shutdownMgr.IsClosed() {
+		t.Error("pubsub should be closed after lifecycle context was cancelled")
+	}
+}
+
+func TestCbPubSub_WatchLifecycle_ReturnsOnClose(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	mockRepo.EXPECT().Delete(gomock.Any(), pubsub.selfDocId).Return(nil)
+	mockRepo.EXPECT().RemoveMultiplePaths(gomock.Any(), constant.AssignmentDocName, gomock.Any()).Return(nil)
+	mockRepo.EXPECT().Close().Return(nil)
+
+	done := make(chan struct{})
+	go func() {
+		pubsub.watchLifecycle(context.Background())
+		close(done)
+	}()
+
+	if err := pubsub.Close(context.Background()); err != nil {
+		t.Errorf("Close returned error: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("watchLifecycle did not return after Close")
+	}
+}
+
+func TestCbPubSub_Close_RepositoryError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	expectedErr := errors.New("close error")
+	mockRepo.EXPECT().Delete(gomock.Any(), pubsub.selfDocId).Return(nil)
+	mockRepo.EXPECT().RemoveMultiplePaths(gomock.Any(), constant.AssignmentDocName, gomock.Any()).Return(nil)
+	mockRepo.EXPECT().Close().Return(expectedErr)
+
+	err := pubsub.Close(context.Background())
+	if !errors.Is(err, expectedErr) {
+		t.Errorf("Close returned error: %v, want %v", err, expectedErr)
+	}
+}
+
+func TestCbPubSub_Close_JoinsTeardownErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	deleteErr := errors.New("delete timeout")
+	removeErr := errors.New("remove timeout")
+	mockRepo.EXPECT().Delete(gomock.Any(), pubsub.selfDocId).Return(deleteErr)
+	mockRepo.EXPECT().RemoveMultiplePaths(gomock.Any(), constant.AssignmentDocName, gomock.Any()).Return(removeErr)
+	mockRepo.EXPECT().Close().Return(nil)
+
+	err := pubsub.Close(context.Background())
+	if !errors.Is(err, deleteErr) || !errors.Is(err, removeErr) {
+		t.Errorf("Close error = %v, want both %v and %v", err, deleteErr, removeErr)
+	}
+	if !strings.Contains(err.Error(), "self document") || !strings.Contains(err.Error(), "assignment entry") {
+		t.Errorf("Close error = %q, want the failed steps named", err)
+	}
+
+	if err = pubsub.Close(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("second Close error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestCbPubSub_Close_IgnoresMissingDocuments(t *testing.T) {
+	tests := []struct {
+		removeErr error
+		name      string
+	}{
+		{name: "missing assignment entry", removeErr: gocb.ErrPathNotFound},
+		{name: "missing assignment document", removeErr: gocb.ErrDocumentNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			pubsub := createTestCbPubSub(t, mockRepo)
+
+			mockRepo.EXPECT().Delete(gomock.Any(), pubsub.selfDocId).Return(gocb.ErrDocumentNotFound)
+			mockRepo.EXPECT().RemoveMultiplePaths(gomock.Any(), constant.AssignmentDocName, gomock.Any()).Return(tt.removeErr)
+			mockRepo.EXPECT().Close().Return(nil)
+
+			if err := pubsub.Close(context.Background()); err != nil {
+				t.Errorf("Close returned error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCbPubSub_Close_NilRepository(t *testing.T) {
+	logger := util.NewDevLogger("test")
+	pubsub := &cbPubSub[string]{
+		shutdownMgr: newShutdownManager(logger.With("component", "shutdown-manager"), constant.DefaultShutdownTimeout),
+	}
+
+	err := pubsub.Close(context.Background())
+	if err != nil {
+		t.Errorf("Close with nil repository returned error: %v", err)
+	}
+}
+
+func TestNewCbPubSub_ConfigDefaults(t *testing.T) {
+	cfg := config.PubSubConfig{
+		CouchbaseConfig: config.CouchbaseConfig{
+			Host:           "couchbase://localhost",
+			Username:       "admin",
+			Password:       "password",
+			BucketName:     "test",
+			ScopeName:      "scope",
+			CollectionName: "collection",
+		},
+	}
+
+	_, err := NewCbPubSub[string]("test-channel", cfg)
+	if err == nil {
+		t.Error("NewCbPubSub should fail with invalid connection")
+	}
+}
+
+func TestPubSubHandler_Function(t *testing.T) {
+	var handlerCalled bool
+	var receivedMessages []string
+
+	handler := func(ctx context.Context, messages []string) error {
+		handlerCalled = true
+		receivedMessages = messages
+		return nil
+	}
+
+	testMessages := []string{"msg1", "msg2", "msg3"}
+	err := handler(context.Background(), testMessages)
+
+	if err != nil {
+		t.Errorf("Handler returned error: %v", err)
+	}
+	if !handlerCalled {
+		t.Error("Handler was not called")
+	}
+	if len(receivedMessages) != 3 {
+		t.Errorf("Handler received %d messages, want 3", len(receivedMessages))
+	}
+	for i, msg := range testMessages {
+		if receivedMessages[i] != msg {
+			t.Errorf("Message %d = %s, want %s", i, receivedMessages[i], msg)
+		}
+	}
+}
+
+func TestPubSubHandler_Error(t *testing.T) {
+	expectedErr := errors.New("handler error")
+	handler := func(ctx context.Context, messages []string) error {
+		return expectedErr
+	}
+
+	err := handler(context.Background(), []string{"test"})
+	if err != expectedErr {
+		t.Errorf("Handler returned error: %v, want %v", err, expectedErr)
+	}
+}
+
+func TestCbPubSub_Publish_SkipSelfInstance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	assignmentDoc := model.AssignmentDoc{
+		"test-channel": {
+			"test-instance":  {Timestamp: 1234567890},
+			"other-instance": {Timestamp: 1234567891},
+		},
+	}
+
+	mockRepo.EXPECT().
+		Get(gomock.Any(), constant.AssignmentDocName, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}) (gocb.Cas, error) {
+			*(result.(*model.AssignmentDoc)) = assignmentDoc
+			return gocb.Cas(123), nil
+		})
+
+	mockRepo.EXPECT().
+		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"other-instance", constant.MessagesPath, testEnvelope(t, "test-message", nil)).
+		Return(nil)
+
+	err := pubsub.Publish(context.Background(), "test-message")
+	if err != nil {
+		t.Errorf("Publish returned error: %v", err)
+	}
+}
+
+func TestCbPubSub_Publish_SkipsNonMatchingFilters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	headers := map[string]string{"tenant": "acme"}
+
+	assignmentDoc := model.AssignmentDoc{
+		"test-channel": {
+			"acme-instance":   {Timestamp: 1234567890, Filter: `headers.tenant == "acme"`},
+			"other-instance":  {Timestamp: 1234567891, Filter: `headers.tenant == "other"`},
+			"plain-instance":  {Timestamp: 1234567892},
+			"broken-instance": {Timestamp: 1234567893, Filter: `tenant ==`},
+		},
+	}
+
+	mockRepo.EXPECT().
+		Get(gomock.Any(), constant.AssignmentDocName, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}) (gocb.Cas, error) {
+			*(result.(*model.AssignmentDoc)) = assignmentDoc
+			return gocb.Cas(123), nil
+		})
+
+	mockRepo.EXPECT().
+		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"acme-instance", constant.MessagesPath, testEnvelope(t, "test-message", headers)).
+		Return(nil)
+
+	mockRepo.EXPECT().
+		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"plain-instance", constant.MessagesPath, testEnvelope(t, "test-message", headers)).
+		Return(nil)
+
+	mockRepo.EXPECT().
+		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"broken-instance", constant.MessagesPath, testEnvelope(t, "test-message", headers)).
+		Return(nil)
+
+	err := pubsub.Publish(context.Background(), "test-message", WithHeaders(headers))
+	if err != nil {
+		t.Errorf("Publish returned error: %v", err)
+	}
+}
+
+func TestCbPubSub_SetFilter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	expectedPath := util.GetAssignmentFieldPath(pubsub.channel, pubsub.instanceId, constant.FilterField)
+	mockRepo.EXPECT().
+		UpsertPath(gomock.Any(), constant.AssignmentDocName, expectedPath, `tenant == "acme"`).
+		Return(nil)
+
+	err := pubsub.SetFilter(context.Background(), `tenant == "acme"`)
+	if err != nil {
+		t.Errorf("SetFilter returned error: %v", err)
+	}
+
+	mockRepo.EXPECT().
+		Upsert(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+		Return(nil)
+
+	mockRepo.EXPECT().
+		UpsertPath(gomock.Any(), constant.AssignmentDocName, util.GetAssignmentPath(pubsub.channel, pubsub.instanceId), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, path string, value interface{}) error {
+			entry := value.(model.AssignmentEntry)
+			if entry.Filter != `tenant == "acme"` {
+				t.Errorf("assign Filter = %s, want %s", entry.Filter, `tenant == "acme"`)
+			}
+			return nil
+		})
+
+	err = pubsub.assign(context.Background())
+	if err != nil {
+		t.Errorf("assign returned error: %v", err)
+	}
+}
+
+func TestCbPubSub_SetFilter_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	err := pubsub.SetFilter(context.Background(), `tenant ==`)
+	if err == nil {
+		t.Error("SetFilter should return error for invalid expression")
+	}
+}
+
+func TestCbPubSub_DecodeAll(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	gobPayload, err := codec.Gob{}.Marshal("gob-message")
+	if err != nil {
+		t.Fatalf("failed to marshal gob message: %v", err)
+	}
+
+	envelopes := []model.Message{
+		testEnvelope(t, "json-message", nil),
+		{Codec: codec.GobName, Payload: gobPayload},
+		{Codec: "unknown", Payload: []byte("x")},
+		{Codec: codec.JSONName, Payload: []byte("{not json")},
+	}
+
+	messages, positions := pubsub.decodeAll(context.Background(), envelopes)
+	if len(messages) != 2 {
+		t.Fatalf("decodeAll returned %d messages, want 2", len(messages))
+	}
+	if messages[0] != "json-message" || messages[1] != "gob-message" {
+		t.Errorf("decodeAll = %v, want [json-message gob-message]", messages)
+	}
+	if positions[0] != 0 || positions[1] != 1 {
+		t.Errorf("decodeAll positions = %v, want [0 1]", positions)
+	}
+}
+
+func TestCbPubSub_EncodeDecode_Compression(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.Compression = constant.CompressionSnappy
+	pubsub.cfg.CompressionThresholdBytes = 64
+
+	small, err := pubsub.encode(context.Background(), "small", nil)
+	if err != nil {
+		t.Fatalf("encode returned error: %v", err)
+	}
+	if small.Encoding != "" {
+		t.Errorf("small message Encoding = %s, want empty", small.Encoding)
+	}
+
+	large := strings.Repeat("compressible ", 100)
+	envelope, err := pubsub.encode(context.Background(), large, nil)
+	if err != nil {
+		t.Fatalf("encode returned error: %v", err)
+	}
+	if envelope.Encoding != constant.CompressionSnappy {
+		t.Errorf("large message Encoding = %s, want %s", envelope.Encoding, constant.CompressionSnappy)
+	}
+
+	decoded, err := pubsub.decode(context.Background(), envelope)
+	if err != nil {
+		t.Fatalf("decode returned error: %v", err)
+	}
+	if decoded != large {
+		t.Error("decoded message does not match original")
+	}
+}
+
+func TestCbPubSub_EncodeDecode_Encryption(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	oldKey := []byte(strings.Repeat("a", 32))
+	newKey := []byte(strings.Repeat("b", 32))
+	pubsub.keyProvider = NewStaticKeyProvider("key-1", map[string][]byte{"key-1": oldKey})
+
+	envelope, err := pubsub.encode(context.Background(), "secret", nil)
+	if err != nil {
+		t.Fatalf("encode returned error: %v", err)
+	}
+	if envelope.KeyId != "key-1" {
+		t.Errorf("KeyId = %s, want key-1", envelope.KeyId)
+	}
+	if strings.Contains(string(envelope.Payload), "secret") {
+		t.Error("encrypted payload contains plaintext")
+	}
+
+	pubsub.keyProvider = NewStaticKeyProvider("key-2", map[string][]byte{"key-1": oldKey, "key-2": newKey})
+	decoded, err := pubsub.decode(context.Background(), envelope)
+	if err != nil {
+		t.Fatalf("decode after rotation returned error: %v", err)
+	}
+	if decoded != "secret" {
+		t.Errorf("decoded = %s, want secret", decoded)
+	}
+}
+
+func TestCbPubSub_DecodeAll_DecryptionFailureDeadLetter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.keyProvider = NewStaticKeyProvider("key-1", map[string][]byte{"key-1": []byte(strings.Repeat("a", 32))})
+
+	encrypted, err := pubsub.encode(context.Background(), "secret", nil)
+	if err != nil {
+		t.Fatalf("encode returned error: %v", err)
+	}
+
+	var deadLetters []error
+	pubsub.deadLetter = func(ctx context.Context, msg model.Message, cause error) {
+		deadLetters = append(deadLetters, cause)
+	}
+	pubsub.keyProvider = NewStaticKeyProvider("key-2", map[string][]byte{"key-2": []byte(strings.Repeat("b", 32))})
+
+	messages, _ := pubsub.decodeAll(context.Background(), []model.Message{encrypted, testEnvelope(t, "plain", nil)})
+	if len(messages) != 1 || messages[0] != "plain" {
+		t.Errorf("decodeAll = %v, want [plain]", messages)
+	}
+	if len(deadLetters) != 1 {
+		t.Fatalf("dead letter count = %d, want 1", len(deadLetters))
+	}
+	if !errors.Is(deadLetters[0], ErrDecryptionFailed) {
+		t.Errorf("dead letter cause = %v, want ErrDecryptionFailed", deadLetters[0])
+	}
+}
+
+func TestCbPubSub_Signing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.signing = &SigningConfig{
+		Keys:   map[string][]byte{"publisher-1": []byte("signing-secret")},
+		KeyId:  "publisher-1",
+		Policy: SignaturePolicyDrop,
+	}
+
+	signed, err := pubsub.encode(context.Background(), "signed", map[string]string{"tenant": "acme"})
+	if err != nil {
+		t.Fatalf("encode returned error: %v", err)
+	}
+	if signed.SignatureKeyId != "publisher-1" || len(signed.Signature) == 0 {
+		t.Fatalf("encode did not sign message: %+v", signed)
+	}
+
+	tampered := signed
+	tampered.Headers = map[string]string{"tenant": "other"}
+
+	unknownKey := signed
+	unknownKey.SignatureKeyId = "publisher-2"
+
+	var deadLetters int
+	pubsub.deadLetter = func(ctx context.Context, msg model.Message, cause error) {
+		deadLetters++
+	}
+
+	envelopes := []model.Message{signed, testEnvelope(t, "unsigned", nil), tampered, unknownKey}
+	messages, _ := pubsub.decodeAll(context.Background(), envelopes)
+	if len(messages) != 1 || messages[0] != "signed" {
+		t.Errorf("decodeAll = %v, want [signed]", messages)
+	}
+	if deadLetters != 0 {
+		t.Errorf("dead letter count = %d, want 0 with drop policy", deadLetters)
+	}
+	if pubsub.Stats().RejectedMessages != 3 {
+		t.Errorf("RejectedMessages = %d, want 3", pubsub.Stats().RejectedMessages)
+	}
+
+	pubsub.signing.Policy = SignaturePolicyDeadLetter
+	pubsub.decodeAll(context.Background(), envelopes)
+	if deadLetters != 3 {
+		t.Errorf("dead letter count = %d, want 3 with dead letter policy", deadLetters)
+	}
+	if pubsub.Stats().RejectedMessages != 6 {
+		t.Errorf("RejectedMessages = %d, want 6", pubsub.Stats().RejectedMessages)
+	}
+}
+
+func TestCbPubSub_Verify_Errors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.signing = &SigningConfig{
+		Keys:  map[string][]byte{"publisher-1": []byte("signing-secret")},
+		KeyId: "publisher-1",
+	}
+
+	err := pubsub.verify(testEnvelope(t, "unsigned", nil))
+	if !errors.Is(err, ErrUnsignedMessage) {
+		t.Errorf("verify unsigned = %v, want ErrUnsignedMessage", err)
+	}
+
+	signed, err := pubsub.encode(context.Background(), "signed", nil)
+	if err != nil {
+		t.Fatalf("encode returned error: %v", err)
+	}
+	signed.Payload = append(signed.Payload, ' ')
+	err = pubsub.verify(signed)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("verify tampered = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestCbPubSub_Overflow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.OverflowThresholdBytes = 32
+	pubsub.cfg.OverflowChunkBytes = 16
+	pubsub.cfg.OverflowTtlSeconds = 3600
+
+	blobs := make(map[string]model.BlobDoc)
+	mockRepo.EXPECT().
+		Upsert(gomock.Any(), gomock.Any(), gomock.Any(), time.Hour).
+		DoAndReturn(func(ctx context.Context, key string, document interface{}, ttl time.Duration) error {
+			if !strings.HasPrefix(key, constant.BlobDocPrefix) {
+				t.Errorf("blob key = %s, want prefix %s", key, constant.BlobDocPrefix)
+			}
+			blobs[key] = document.(model.BlobDoc)
+			return nil
+		}).
+		Times(3)
+
+	large := strings.Repeat("x", 40)
+	envelope, err := pubsub.encode(context.Background(), large, nil)
+	if err != nil {
+		t.Fatalf("encode returned error: %v", err)
+	}
+	if envelope.Blob == nil {
+		t.Fatal("large message should be offloaded to a blob")
+	}
+	if envelope.Payload != nil {
+		t.Error("offloaded message should not carry a payload")
+	}
+	if envelope.Blob.Chunks != 3 || envelope.Blob.Size != 42 {
+		t.Errorf("Blob = %+v, want 3 chunks and 42 bytes", envelope.Blob)
+	}
+
+	mockRepo.EXPECT().
+		Get(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}) (gocb.Cas, error) {
+			*(result.(*model.BlobDoc)) = blobs[key]
+			return gocb.Cas(1), nil
+		}).
+		Times(3)
+
+	messages, _ := pubsub.decodeAll(context.Background(), []model.Message{envelope})
+	if len(messages) != 1 || messages[0] != large {
+		t.Errorf("decodeAll = %v, want offloaded message", messages)
+	}
+}
+
+func TestCbPubSub_Overflow_MissingBlob(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.subscribeRetryConfig.MaxRetries = 0
+
+	mockRepo.EXPECT().
+		Get(gomock.Any(), constant.BlobDocPrefix+"missing_0", gomock.Any()).
+		Return(gocb.Cas(0), gocb.ErrDocumentNotFound)
+
+	var cause error
+	pubsub.deadLetter = func(ctx context.Context, msg model.Message, err error) {
+		cause = err
+	}
+
+	envelope := model.Message{Codec: codec.JSONName, Blob: &model.BlobRef{Id: "missing", Chunks: 1, Size: 10}}
+	messages, _ := pubsub.decodeAll(context.Background(), []model.Message{envelope})
+	if len(messages) != 0 {
+		t.Errorf("decodeAll returned %d messages, want 0", len(messages))
+	}
+	if !errors.Is(cause, ErrBlobUnavailable) {
+		t.Errorf("dead letter cause = %v, want ErrBlobUnavailable", cause)
+	}
+}
+
+func expectAssignmentDoc(mockRepo *mocks.MockRepository, assignmentDoc model.AssignmentDoc) {
+	mockRepo.EXPECT().
+		Get(gomock.Any(), constant.AssignmentDocName, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}) (gocb.Cas, error) {
+			*(result.(*model.AssignmentDoc)) = assignmentDoc
+			return gocb.Cas(123), nil
+		})
+}
+
+func TestCbPubSub_Publish_QueueFullPolicies(t *testing.T) {
+	assignmentDoc := model.AssignmentDoc{
+		"test-channel": {
+			"fast-instance": {Timestamp: 1234567890},
+			"slow-instance": {Timestamp: 1234567891},
+		},
+	}
+
+	tests := []struct {
+		setup  func(t *testing.T, mockRepo *mocks.MockRepository)
+		name   string
+		policy string
+	}{
+		{
+			name:   "reject",
+			policy: constant.QueueFullPolicyReject,
+			setup:  func(t *testing.T, mockRepo *mocks.MockRepository) {},
+		},
+		{
+			name:   "drop newest",
+			policy: constant.QueueFullPolicyDropNewest,
+			setup: func(t *testing.T, mockRepo *mocks.MockRepository) {
+				mockRepo.EXPECT().
+					ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"fast-instance", constant.MessagesPath, testEnvelope(t, "test-message", nil)).
+					Return(nil)
+			},
+		},
+		{
+			name:   "drop oldest",
+			policy: constant.QueueFullPolicyDropOldest,
+			setup: func(t *testing.T, mockRepo *mocks.MockRepository) {
+				mockRepo.EXPECT().
+					ArrayHeadState(gomock.Any(), constant.SelfDocPrefix+"slow-instance", constant.MessagesPath, constant.HeadSeqPath).
+					Return(repository.ArrayState{Count: 11, Seq: 4, Cas: gocb.Cas(7)}, nil)
+				mockRepo.EXPECT().
+					ArrayRemoveHead(gomock.Any(), constant.SelfDocPrefix+"slow-instance", constant.MessagesPath, constant.HeadSeqPath, 2, gocb.Cas(7)).
+					Return(nil)
+				mockRepo.EXPECT().
+					ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"fast-instance", constant.MessagesPath, testEnvelope(t, "test-message", nil)).
+					Return(nil)
+				mockRepo.EXPECT().
+					ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"slow-instance", constant.MessagesPath, testEnvelope(t, "test-message", nil)).
+					Return(nil)
+			},
+		},
+		{
+			name:   "overflow",
+			policy: constant.QueueFullPolicyOverflow,
+			setup: func(t *testing.T, mockRepo *mocks.MockRepository) {
+				mockRepo.EXPECT().
+					Upsert(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil)
+				mockRepo.EXPECT().
+					ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"fast-instance", constant.MessagesPath, testEnvelope(t, "test-message", nil)).
+					Return(nil)
+				mockRepo.EXPECT().
+					ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"slow-instance", constant.MessagesPath, gomock.Any()).
+					DoAndReturn(func(ctx context.Context, key string, path string, values interface{}) error {
+						if values.(model.Message).Blob == nil {
+							t.Error("saturated member should receive a blob reference")
+						}
+						return nil
+					})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			pubsub := createTestCbPubSub(t, mockRepo)
+			pubsub.cfg.MaxQueueDepth = 10
+			pubsub.cfg.QueueFullPolicy = tt.policy
+			pubsub.cfg.OverflowChunkBytes = 1024
+
+			expectAssignmentDoc(mockRepo, assignmentDoc)
+			mockRepo.EXPECT().
+				ArrayCount(gomock.Any(), constant.SelfDocPrefix+"fast-instance", constant.MessagesPath).
+				Return(3, nil)
+			mockRepo.EXPECT().
+				ArrayCount(gomock.Any(), constant.SelfDocPrefix+"slow-instance", constant.MessagesPath).
+				Return(11, nil)
+			tt.setup(t, mockRepo)
+
+			var reported []string
+			err := pubsub.Publish(context.Background(), "test-message", WithSaturatedMembers(func(members []string) {
+				reported = members
+			}))
+			if tt.policy != constant.QueueFullPolicyReject {
+				if err != nil {
+					t.Fatalf("Publish error = %v, want nil", err)
+				}
+				if got := pubsub.Stats().SaturatedDeliveries; got != 1 {
+					t.Errorf("SaturatedDeliveries = %d, want 1", got)
+				}
+				if len(reported) != 1 || reported[0] != "slow-instance" {
+					t.Errorf("reported saturated members = %v, want [slow-instance]", reported)
+				}
+				return
+			}
+			if reported != nil {
+				t.Errorf("reported saturated members = %v, want none on reject", reported)
+			}
+
+			var queueFullErr *QueueFullError
+			if !errors.As(err, &queueFullErr) {
+				t.Fatalf("Publish error = %v, want *QueueFullError", err)
+			}
+			if !errors.Is(err, ErrQueueFull) {
+				t.Errorf("Publish error = %v, want ErrQueueFull", err)
+			}
+			if len(queueFullErr.Members) != 1 || queueFullErr.Members[0] != "slow-instance" {
+				t.Errorf("saturated members = %v, want [slow-instance]", queueFullErr.Members)
+			}
+			if queueFullErr.Policy != tt.policy {
+				t.Errorf("Policy = %s, want %s", queueFullErr.Policy, tt.policy)
+			}
+		})
+	}
+}
+
+func TestCbPubSub_Publish_DropOldestRacingAck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.MaxQueueDepth = 10
+	pubsub.cfg.QueueFullPolicy = constant.QueueFullPolicyDropOldest
+
+	slowDocId := constant.SelfDocPrefix + "slow-instance"
+	expectAssignmentDoc(mockRepo, model.AssignmentDoc{
+		"test-channel": {
+			"slow-instance": {Timestamp: 1234567890},
+		},
+	})
+	mockRepo.EXPECT().
+		ArrayCount(gomock.Any(), slowDocId, constant.MessagesPath).
+		Return(10, nil)
+	gomock.InOrder(
+		mockRepo.EXPECT().
+			ArrayHeadState(gomock.Any(), slowDocId, constant.MessagesPath, constant.HeadSeqPath).
+			Return(repository.ArrayState{Count: 10, Seq: 0, Cas: gocb.Cas(7)}, nil),
+		mockRepo.EXPECT().
+			ArrayRemoveHead(gomock.Any(), slowDocId, constant.MessagesPath, constant.HeadSeqPath, 1, gocb.Cas(7)).
+			Return(gocb.ErrCasMismatch),
+		mockRepo.EXPECT().
+			ArrayHeadState(gomock.Any(), slowDocId, constant.MessagesPath, constant.HeadSeqPath).
+			Return(repository.ArrayState{Count: 4, Seq: 6, Cas: gocb.Cas(8)}, nil),
+		mockRepo.EXPECT().
+			ArrayAppend(gomock.Any(), slowDocId, constant.MessagesPath, testEnvelope(t, "test-message", nil)).
+			Return(nil),
+	)
+
+	err := pubsub.Publish(context.Background(), "test-message")
+	if err != nil {
+		t.Fatalf("Publish error = %v, want nil", err)
+	}
+}
+
+func TestCbPubSub_Publish_QueueDepthBelowLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.MaxQueueDepth = 10
+	pubsub.cfg.QueueFullPolicy = constant.QueueFullPolicyReject
+
+	expectAssignmentDoc(mockRepo, model.AssignmentDoc{
+		"test-channel": {
+			"instance1": {Timestamp: 1234567890},
+			"gone":      {Timestamp: 1234567891},
+		},
+	})
+	mockRepo.EXPECT().
+		ArrayCount(gomock.Any(), constant.SelfDocPrefix+"instance1", constant.MessagesPath).
+		Return(9, nil)
+	mockRepo.EXPECT().
+		ArrayCount(gomock.Any(), constant.SelfDocPrefix+"gone", constant.MessagesPath).
+		Return(0, gocb.ErrDocumentNotFound)
+	mockRepo.EXPECT().
+		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"instance1", constant.MessagesPath, testEnvelope(t, "test-message", nil)).
+		Return(nil)
+	mockRepo.EXPECT().
+		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"gone", constant.MessagesPath, testEnvelope(t, "test-message", nil)).
+		Return(gocb.ErrDocumentNotFound)
+
+	err := pubsub.Publish(context.Background(), "test-message")
+	if err != nil {
+		t.Errorf("Publish returned error: %v", err)
+	}
+}
+
+func TestCbPubSub_Publish_RejectWritesNoBlob(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.MaxQueueDepth = 10
+	pubsub.cfg.QueueFullPolicy = constant.QueueFullPolicyReject
+	pubsub.cfg.OverflowThresholdBytes = 1
+	pubsub.cfg.OverflowChunkBytes = 1024
+
+	expectAssignmentDoc(mockRepo, model.AssignmentDoc{
+		"test-channel": {"slow-instance": {Timestamp: 1234567890}},
+	})
+	mockRepo.EXPECT().
+		ArrayCount(gomock.Any(), constant.SelfDocPrefix+"slow-instance", constant.MessagesPath).
+		Return(10, nil)
+	mockRepo.EXPECT().Upsert(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	err := pubsub.Publish(context.Background(), "test-message")
+	if !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Publish error = %v, want %v", err, ErrQueueFull)
+	}
+}
+
+func rawEnvelopes(t *testing.T, msgs ...string) []json.RawMessage {
+	items := make([]json.RawMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		data, err := json.Marshal(testEnvelope(t, msg, nil))
+		if err != nil {
+			t.Fatalf("failed to marshal envelope: %v", err)
+		}
+		items = append(items, data)
+	}
+	return items
+}
+
+func expectAck(mockRepo *mocks.MockRepository, docId string, seq int64, count int) *gomock.Call {
+	state := mockRepo.EXPECT().
+		ArrayHeadState(gomock.Any(), docId, constant.MessagesPath, constant.HeadSeqPath).
+		Return(repository.ArrayState{Count: count, Seq: seq, Cas: gocb.Cas(7)}, nil)
+	return mockRepo.EXPECT().
+		ArrayRemoveHead(gomock.Any(), docId, constant.MessagesPath, constant.HeadSeqPath, count, gocb.Cas(7)).
+		After(state)
+}
+
+func pollOnce(c *cbPubSub[string], handler PubSubHandler[string]) error {
+	c.addSubscription(context.Background(), handler)
+	_, err := c.poll(context.Background())
+	return err
+}
+
+func TestCbPubSub_Drain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.paused.Store(true)
+
+	ownPath := []string{util.GetAssignmentPath(pubsub.channel, pubsub.instanceId)}
+	gomock.InOrder(
+		mockRepo.EXPECT().RemoveMultiplePaths(gomock.Any(), constant.AssignmentDocName, ownPath).Return(nil),
+		mockRepo.EXPECT().
+			GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
+				doc := result.(*model.PubSubDoc[model.Message])
+				doc.Messages = []model.Message{testEnvelope(t, "msg1", nil), testEnvelope(t, "msg2", nil)}
+				return gocb.Cas(1), nil
+			}),
+		expectAck(mockRepo, pubsub.selfDocId, 0, 2).Return(nil),
+		mockRepo.EXPECT().GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).Return(gocb.Cas(2), nil),
+		mockRepo.EXPECT().Delete(gomock.Any(), pubsub.selfDocId).Return(nil),
+		mockRepo.EXPECT().RemoveMultiplePaths(gomock.Any(), constant.AssignmentDocName, ownPath).Return(nil),
+		mockRepo.EXPECT().Close().Return(nil),
+	)
+
+	var received []string
+	pubsub.addSubscription(context.Background(), func(ctx context.Context, messages []string) error {
+		received = append(received, messages...)
+		return nil
+	})
+
+	if err := pubsub.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain returned error: %v", err)
+	}
+	if len(received) != 2 {
+		t.Errorf("handler received %d messages, want 2", len(received))
+	}
+	if !pubsub.shutdownMgr.IsClosed() {
+		t.Error("pubsub should be closed after Drain")
+	}
+	if err := pubsub.register(context.Background()); err != nil {
+		t.Errorf("register returned error while draining: %v", err)
+	}
+}
+
+func TestCbPubSub_Drain_DeadlineExceeded(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.MinPollInterval = 10 * time.Millisecond
+
+	mockRepo.EXPECT().RemoveMultiplePaths(gomock.Any(), constant.AssignmentDocName, gomock.Any()).Return(nil).Times(2)
+	mockRepo.EXPECT().
+		GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
+			doc := result.(*model.PubSubDoc[model.Message])
+			doc.Messages = []model.Message{testEnvelope(t, "msg1", nil)}
+			return gocb.Cas(1), nil
+		}).AnyTimes()
+	mockRepo.EXPECT().Delete(gomock.Any(), pubsub.selfDocId).Return(nil)
+	mockRepo.EXPECT().Close().Return(nil)
+
+	pubsub.addSubscription(context.Background(), func(ctx context.Context, messages []string) error {
+		return errors.New("handler failed")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := pubsub.Drain(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Drain error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !pubsub.shutdownMgr.IsClosed() {
+		t.Error("pubsub should be closed after Drain")
+	}
+}
+
+func TestCbPubSub_Drain_DeregisterError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	mockRepo.EXPECT().
+		RemoveMultiplePaths(gomock.Any(), constant.AssignmentDocName, gomock.Any()).
+		Return(errors.New("timeout"))
+
+	if err := pubsub.Drain(context.Background()); err == nil {
+		t.Error("Drain should return error when deregistration fails")
+	}
+	if pubsub.shutdownMgr.IsClosed() {
+		t.Error("pubsub should stay open when deregistration fails")
+	}
+	if pubsub.draining.Load() {
+		t.Error("draining should be reset when deregistration fails")
+	}
+}
+
+func TestCbPubSub_Drain_AfterClose(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	_ = pubsub.shutdownMgr.Shutdown(context.Background(), nil)
+
+	if err := pubsub.Drain(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Drain error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestCbPubSub_Poll_FullDocument(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	mockRepo.EXPECT().
+		GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
+			doc := result.(*model.PubSubDoc[model.Message])
+			doc.Messages = []model.Message{testEnvelope(t, "msg1", nil), testEnvelope(t, "msg2", nil)}
+			return gocb.Cas(1), nil
+		})
+	expectAck(mockRepo, pubsub.selfDocId, 0, 2).
+		Return(nil)
+
+	var received []string
+	err := pollOnce(pubsub, func(ctx context.Context, messages []string) error {
+		received = append(received, messages...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("poll returned error: %v", err)
+	}
+	if len(received) != 2 {
+		t.Errorf("handler received %d messages, want 2", len(received))
+	}
+}
+
+func TestCbPubSub_Poll_LegacyRawMessages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	mockRepo.EXPECT().
+		GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
+			doc := `{"messages":["legacy",{"codec":"json","payload":"enveloped"}],"creationDate":1234567890}`
+			return gocb.Cas(1), json.Unmarshal([]byte(doc), result)
+		})
+	expectAck(mockRepo, pubsub.selfDocId, 0, 2).
+		Return(nil)
+
+	var received []string
+	err := pollOnce(pubsub, func(ctx context.Context, messages []string) error {
+		received = append(received, messages...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("poll returned error: %v", err)
+	}
+	if len(received) != 2 || received[0] != "legacy" || received[1] != "enveloped" {
+		t.Errorf("received = %v, want [legacy enveloped]", received)
+	}
+}
+
+func TestCbPubSub_Poll_AckRetryRemovesOnlyUnappliedChunk(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	mockRepo.EXPECT().
+		GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
+			doc := result.(*model.PubSubDoc[model.Message])
+			doc.HeadSeq = 40
+			for i := 0; i < 20; i++ {
+				doc.Messages = append(doc.Messages, testEnvelope(t, fmt.Sprintf("msg%d", i), nil))
+			}
+			return gocb.Cas(1), nil
+		})
+	gomock.InOrder(
+		mockRepo.EXPECT().
+			ArrayHeadState(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath).
+			Return(repository.ArrayState{Count: 22, Seq: 40, Cas: gocb.Cas(2)}, nil),
+		mockRepo.EXPECT().
+			ArrayRemoveHead(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath, 15, gocb.Cas(2)).
+			Return(nil),
+		mockRepo.EXPECT().
+			ArrayHeadState(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath).
+			Return(repository.ArrayState{Count: 7, Seq: 55, Cas: gocb.Cas(3)}, nil),
+		mockRepo.EXPECT().
+			ArrayRemoveHead(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath, 5, gocb.Cas(3)).
+			Return(errors.New("timeout")),
+		mockRepo.EXPECT().
+			ArrayHeadState(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath).
+			Return(repository.ArrayState{Count: 7, Seq: 55, Cas: gocb.Cas(4)}, nil),
+		mockRepo.EXPECT().
+			ArrayRemoveHead(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath, 5, gocb.Cas(4)).
+			Return(nil),
+	)
+
+	received := 0
+	err := pollOnce(pubsub, func(ctx context.Context, messages []string) error {
+		received += len(messages)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("poll returned error: %v", err)
+	}
+	if received != 20 {
+		t.Errorf("handler received %d messages, want 20", received)
+	}
+}
+
+func TestCbPubSub_Poll_AckRetriesOnCasMismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	mockRepo.EXPECT().
+		GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
+			doc := result.(*model.PubSubDoc[model.Message])
+			doc.Messages = []model.Message{testEnvelope(t, "msg1", nil), testEnvelope(t, "msg2", nil)}
+			return gocb.Cas(1), nil
+		})
+	gomock.InOrder(
+		mockRepo.EXPECT().
+			ArrayHeadState(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath).
+			Return(repository.ArrayState{Count: 2, Seq: 0, Cas: gocb.Cas(2)}, nil),
+		mockRepo.EXPECT().
+			ArrayRemoveHead(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath, 2, gocb.Cas(2)).
+			Return(gocb.ErrCasMismatch),
+		mockRepo.EXPECT().
+			ArrayHeadState(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath).
+			Return(repository.ArrayState{Count: 1, Seq: 1, Cas: gocb.Cas(3)}, nil),
+		mockRepo.EXPECT().
+			ArrayRemoveHead(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath, 1, gocb.Cas(3)).
+			Return(nil),
+	)
+
+	err := pollOnce(pubsub, func(ctx context.Context, messages []string) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("poll returned error: %v", err)
+	}
+}
+
+func TestCbPubSub_Poll_MaxBatchSize(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.MaxBatchSize = 2
+
+	mockRepo.EXPECT().Touch(gomock.Any(), pubsub.selfDocId, gomock.Any()).Return(nil)
+	gomock.InOrder(
+		mockRepo.EXPECT().ArrayGetRange(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath, 0, 1).Return(rawEnvelopes(t, "msg1", "msg2"), repository.ArrayState{Count: 5}, nil),
+		expectAck(mockRepo, pubsub.selfDocId, 0, 2).Return(nil),
+		mockRepo.EXPECT().ArrayGetRange(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath, 0, 1).Return(rawEnvelopes(t, "msg3", "msg4"), repository.ArrayState{Count: 3, Seq: 2}, nil),
+		expectAck(mockRepo, pubsub.selfDocId, 2, 2).Return(nil),
+		mockRepo.EXPECT().ArrayGetRange(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath, 0, 1).Return(rawEnvelopes(t, "msg5"), repository.ArrayState{Count: 1, Seq: 4}, nil),
+		expectAck(mockRepo, pubsub.selfDocId, 4, 1).Return(nil),
+	)
+
+	var batches [][]string
+	err := pollOnce(pubsub, func(ctx context.Context, messages []string) error {
+		batches = append(batches, messages)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("poll returned error: %v", err)
+	}
+	if len(batches) != 3 {
+		t.Fatalf("handler called %d times, want 3", len(batches))
+	}
+	if len(batches[0]) != 2 || len(batches[1]) != 2 || len(batches[2]) != 1 {
+		t.Errorf("batch sizes = %d, %d, %d, want 2, 2, 1", len(batches[0]), len(batches[1]), len(batches[2]))
+	}
+}
+
+func TestCbPubSub_Poll_MaxBatchSize_HandlerErrorStops(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.MaxBatchSize = 2
+
+	mockRepo.EXPECT().Touch(gomock.Any(), pubsub.selfDocId, gomock.Any()).Return(nil)
+	mockRepo.EXPECT().
+		ArrayGetRange(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath, 0, 1).
+		Return(rawEnvelopes(t, "msg1", "msg2"), repository.ArrayState{Count: 5}, nil)
+
+	calls := 0
+	err := pollOnce(pubsub, func(ctx context.Context, messages []string) error {
+		calls++
+		return errors.New("handler error")
+	})
+	if err != nil {
+		t.Fatalf("poll returned error: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+}
+
+func TestCbPubSub_Poll_MaxBatchSize_FetchFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.MaxBatchSize = 2
+	pubsub.subscribeRetryConfig.MaxRetries = 0
+
+	fetchErr := errors.New("fetch failed")
+	mockRepo.EXPECT().Touch(gomock.Any(), pubsub.selfDocId, gomock.Any()).Return(nil)
+	mockRepo.EXPECT().
+		ArrayGetRange(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath, 0, 1).
+		Return(nil, repository.ArrayState{}, fetchErr)
+
+	err := pollOnce(pubsub, func(ctx context.Context, messages []string) error {
+		t.Error("handler should not be called when the batch cannot be fetched")
+		return nil
+	})
+	if !errors.Is(err, fetchErr) {
+		t.Errorf("poll error = %v, want %v", err, fetchErr)
+	}
+}
+
+func TestCbPubSub_Poll_MaxBatchSize_RecreatesSelfDoc(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.MaxBatchSize = 2
+
+	mockRepo.EXPECT().Touch(gomock.Any(), pubsub.selfDocId, gomock.Any()).Return(gocb.ErrDocumentNotFound)
+	mockRepo.EXPECT().Upsert(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).Return(nil)
+	mockRepo.EXPECT().UpsertPath(gomock.Any(), constant.AssignmentDocName, gomock.Any(), gomock.Any()).Return(nil)
+	mockRepo.EXPECT().
+		ArrayGetRange(gomock.Any(), pubsub.selfDocId, constant.MessagesPath, constant.HeadSeqPath, 0, 1).
+		Return([]json.RawMessage{}, repository.ArrayState{Count: 0}, nil)
+
+	err := pollOnce(pubsub, func(ctx context.Context, messages []string) error {
+		t.Error("handler should not be called for empty document")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("poll returned error: %v", err)
+	}
+}
+
+func TestCbPubSub_Poll_HandlerConcurrency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.HandlerConcurrency = 3
+
+	mockRepo.EXPECT().
+		GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
+			doc := result.(*model.PubSubDoc[model.Message])
+			for _, msg := range []string{"msg1", "msg2", "msg3", "msg4", "msg5"} {
+				doc.Messages = append(doc.Messages, testEnvelope(t, msg, nil))
+			}
+			return gocb.Cas(1), nil
+		})
+	expectAck(mockRepo, pubsub.selfDocId, 0, 5).
+		Return(nil)
+
+	var mu sync.Mutex
+	received := make(map[string]bool)
+	err := pollOnce(pubsub, func(ctx context.Context, messages []string) error {
+		if len(messages) != 1 {
+			t.Errorf("handler received %d messages, want 1", len(messages))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, msg := range messages {
+			received[msg] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("poll returned error: %v", err)
+	}
+	if len(received) != 5 {
+		t.Errorf("handler received %d distinct messages, want 5", len(received))
+	}
+}
+
+func TestCbPubSub_Poll_HandlerConcurrency_RemovesCompletedPrefix(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.HandlerConcurrency = 2
+
+	mockRepo.EXPECT().
+		GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
+			doc := result.(*model.PubSubDoc[model.Message])
+			for _, msg := range []string{"msg1", "msg2", "fail", "msg4"} {
+				doc.Messages = append(doc.Messages, testEnvelope(t, msg, nil))
+			}
+			return gocb.Cas(1), nil
+		})
+	expectAck(mockRepo, pubsub.selfDocId, 0, 2).
+		Return(nil)
+
+	err := pollOnce(pubsub, func(ctx context.Context, messages []string) error {
+		if messages[0] == "fail" {
+			return errors.New("handler error")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("poll returned error: %v", err)
+	}
+}
+
+func TestCbPubSub_Dispatch_OrderingKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.HandlerConcurrency = 4
+	pubsub.orderingKey = func(msg string) string {
+		return strings.Split(msg, "-")[0]
+	}
+
+	messages := []string{"a-1", "b-1", "a-2", "c-1", "b-2", "a-3", "c-2", "b-3"}
+	positions := []int{0, 1, 2, 3, 4, 5, 6, 7}
+
+	var mu sync.Mutex
+	order := make(map[string][]string)
+	completed := pubsub.dispatch(context.Background(), func(ctx context.Context, batch []string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		key := strings.Split(batch[0], "-")[0]
+		order[key] = append(order[key], batch[0])
+		return nil
+	}, messages, positions, len(messages))
+
+	if completed != len(messages) {
+		t.Errorf("dispatch completed = %d, want %d", completed, len(messages))
+	}
+	expected := map[string][]string{
+		"a": {"a-1", "a-2", "a-3"},
+		"b": {"b-1", "b-2", "b-3"},
+		"c": {"c-1", "c-2"},
+	}
+	for key, want := range expected {
+		if strings.Join(order[key], ",") != strings.Join(want, ",") {
+			t.Errorf("order[%s] = %v, want %v", key, order[key], want)
+		}
+	}
+}
+
+func TestCbPubSub_Dispatch_OrderingKeySkipsAfterFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.HandlerConcurrency = 2
+	pubsub.orderingKey = func(msg string) string {
+		return strings.Split(msg, "-")[0]
+	}
+
+	var mu sync.Mutex
+	var handled []string
+	completed := pubsub.dispatch(context.Background(), func(ctx context.Context, batch []string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, batch[0])
+		if batch[0] == "a-1" {
+			return errors.New("handler error")
+		}
+		return nil
+	}, []string{"a-1", "a-2"}, []int{0, 1}, 2)
+
+	if completed != 0 {
+		t.Errorf("dispatch completed = %d, want 0", completed)
+	}
+	if len(handled) != 1 {
+		t.Errorf("handler called for %v, want only a-1", handled)
+	}
+}
+
+func TestNewCbPubSub_OrderingKeyTypeMismatch(t *testing.T) {
+	cfg := config.PubSubConfig{}
+	_, err := NewCbPubSub[string]("test-channel", cfg, WithOrderingKey(func(msg int) string { return "" }))
+	if err == nil {
+		t.Error("NewCbPubSub should return error for mismatched ordering key type")
+	}
+}
+
+func TestCbPubSub_Invoke_RecoversPanic(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	err := pubsub.invoke(context.Background(), func(ctx context.Context, messages []string) error {
+		panic("boom")
+	}, []string{"msg1"})
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("invoke error = %v, want *PanicError", err)
+	}
+	if panicErr.Value != "boom" {
+		t.Errorf("PanicError.Value = %v, want boom", panicErr.Value)
+	}
+	if len(panicErr.Stack) == 0 {
+		t.Error("PanicError.Stack should not be empty")
+	}
+}
+
+func TestCbPubSub_Invoke_Deadline(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.HandlerTimeoutSec = 1
+
+	err := pubsub.invoke(context.Background(), func(ctx context.Context, messages []string) error {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Fatal("handler context should have a deadline")
+		}
+		if remaining := time.Until(deadline); remaining > time.Second {
+			t.Errorf("handler deadline in %v, want at most 1s", remaining)
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}, []string{"msg1"})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("invoke error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestCbPubSub_Poll_HandlerPanicKeepsMessages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	mockRepo.EXPECT().
+		GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
+			doc := result.(*model.PubSubDoc[model.Message])
+			doc.Messages = []model.Message{testEnvelope(t, "msg1", nil)}
+			return gocb.Cas(1), nil
+		})
+
+	err := pollOnce(pubsub, func(ctx context.Context, messages []string) error {
+		panic("boom")
+	})
+	if err != nil {
+		t.Errorf("poll returned error: %v", err)
+	}
+}
+
+func TestChain_Order(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware[string] {
+		return func(next PubSubHandler[string]) PubSubHandler[string] {
+			return func(ctx context.Context, messages []string) error {
+				calls = append(calls, name+"-before")
+				err := next(ctx, messages)
+				calls = append(calls, name+"-after")
+				return err
+			}
+		}
+	}
+
+	handler := Chain(func(ctx context.Context, messages []string) error {
+		calls = append(calls, "handler")
+		return nil
+	}, record("first"), record("second"))
+
+	err := handler(context.Background(), []string{"msg1"})
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	expected := "first-before,second-before,handler,second-after,first-after"
+	if strings.Join(calls, ",") != expected {
+		t.Errorf("calls = %v, want %s", calls, expected)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	handler := Chain(func(ctx context.Context, messages []string) error {
+		panic("boom")
+	}, Recovery[string]())
+
+	err := handler(context.Background(), []string{"msg1"})
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("handler error = %v, want *PanicError", err)
+	}
+	if panicErr.Value != "boom" {
+		t.Errorf("PanicError.Value = %v, want boom", panicErr.Value)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	expectedErr := errors.New("handler error")
+	handler := Chain(func(ctx context.Context, messages []string) error {
+		return expectedErr
+	}, Logging[string](util.NewDevLogger("test")))
+
+	err := handler(context.Background(), []string{"msg1"})
+	if err != expectedErr {
+		t.Errorf("handler error = %v, want %v", err, expectedErr)
+	}
+}
+
+func TestCbPubSub_Use_WrapsSubscribeHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	pubsub.Use(func(next PubSubHandler[string]) PubSubHandler[string] {
+		return func(ctx context.Context, messages []string) error {
+			return next(ctx, append(messages, "from-middleware"))
+		}
+	})
+
+	var received []string
+	handler := pubsub.wrapHandler(func(ctx context.Context, messages []string) error {
+		received = messages
+		return nil
+	})
+	err := handler(context.Background(), []string{"msg1"})
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if len(received) != 2 || received[1] != "from-middleware" {
+		t.Errorf("received = %v, want [msg1 from-middleware]", received)
+	}
+}
+
+func TestCbPubSub_UsePublish(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	expectAssignmentDoc(mockRepo, model.AssignmentDoc{
+		"test-channel": {
+			"other-instance": {Timestamp: 1234567890},
+		},
+	})
+	expectedHeaders := map[string]string{"trace-id": "abc"}
+	mockRepo.EXPECT().
+		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"other-instance", constant.MessagesPath, testEnvelope(t, "test-message", expectedHeaders)).
+		Return(nil)
+
+	pubsub.UsePublish(func(next PublishFunc[string]) PublishFunc[string] {
+		return func(ctx context.Context, msg string, headers map[string]string) error {
+			return next(ctx, msg, map[string]string{"trace-id": "abc"})
+		}
+	})
+
+	err := pubsub.Publish(context.Background(), "test-message")
+	if err != nil {
+		t.Errorf("Publish returned error: %v", err)
+	}
+}
+
+func TestCbPubSub_UsePublish_ShortCircuit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	expectedErr := errors.New("validation failed")
+	pubsub.UsePublish(func(next PublishFunc[string]) PublishFunc[string] {
+		return func(ctx context.Context, msg string, headers map[string]string) error {
+			return expectedErr
+		}
+	})
+
+	err := pubsub.Publish(context.Background(), "test-message")
+	if err != expectedErr {
+		t.Errorf("Publish error = %v, want %v", err, expectedErr)
+	}
+}
+
+func TestCbPubSub_Deliver_ImplicitAck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	out := make(chan Delivery[string])
+	done := make(chan error, 1)
+	go func() {
+		done <- pubsub.deliver(context.Background(), out, []string{"msg1", "msg2", "msg3"})
+	}()
+
+	var received []string
+	for i := 0; i < 3; i++ {
+		delivery := <-out
+		received = append(received, delivery.Message)
+		if i == 2 {
+			delivery.Ack()
+		}
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("deliver returned error: %v", err)
+	}
+	if strings.Join(received, ",") != "msg1,msg2,msg3" {
+		t.Errorf("received = %v, want [msg1 msg2 msg3]", received)
+	}
+}
+
+func TestCbPubSub_Deliver_UnackedTail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan Delivery[string])
+	done := make(chan error, 1)
+	go func() {
+		done <- pubsub.deliver(ctx, out, []string{"msg1", "msg2", "msg3"})
+	}()
+
+	<-out
+	<-out
+	cancel()
+
+	err := <-done
+	var partial *partialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("deliver error = %v, want *partialError", err)
+	}
+	if partial.completed != 1 {
+		t.Errorf("completed = %d, want 1", partial.completed)
+	}
+}
+
+func TestCbPubSub_Dispatch_PartialError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	completed := pubsub.dispatch(context.Background(), func(ctx context.Context, messages []string) error {
+		return &partialError{completed: 2, cause: context.DeadlineExceeded}
+	}, []string{"msg1", "msg2", "msg3"}, []int{0, 2, 3}, 5)
+
+	if completed != 3 {
+		t.Errorf("dispatch completed = %d, want 3", completed)
+	}
+}
+
+func TestCbPubSub_Messages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	removed := make(chan struct{})
+	gomock.InOrder(
+		mockRepo.EXPECT().
+			GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
+				doc := result.(*model.PubSubDoc[model.Message])
+				doc.Messages = []model.Message{testEnvelope(t, "msg1", nil), testEnvelope(t, "msg2", nil)}
+				return gocb.Cas(1), nil
+			}),
+		expectAck(mockRepo, pubsub.selfDocId, 0, 2).
+			DoAndReturn(func(ctx context.Context, key, path, seqPath string, count int, cas gocb.Cas) error {
+				close(removed)
+				return nil
+			}),
+		mockRepo.EXPECT().
+			GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+			Return(gocb.Cas(1), nil).
+			AnyTimes(),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	deliveries := pubsub.Messages(ctx)
+	first := <-deliveries
+	second := <-deliveries
+	second.Ack()
+	if first.Message != "msg1" || second.Message != "msg2" {
+		t.Errorf("messages = %s, %s, want msg1, msg2", first.Message, second.Message)
+	}
+
+	select {
+	case <-removed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("acknowledged messages were not removed")
+	}
+
+	cancel()
+	for range deliveries {
+		t.Error("no more deliveries expected after cancel")
+	}
+	if err := pubsub.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestCbPubSub_PauseResume(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	expectedPath := util.GetAssignmentFieldPath(pubsub.channel, pubsub.instanceId, constant.PausedField)
+	gomock.InOrder(
+		mockRepo.EXPECT().UpsertPath(gomock.Any(), constant.AssignmentDocName, expectedPath, true).Return(nil),
+		mockRepo.EXPECT().UpsertPath(gomock.Any(), constant.AssignmentDocName, expectedPath, false).Return(nil),
+	)
+
+	if err := pubsub.Pause(context.Background()); err != nil {
+		t.Fatalf("Pause returned error: %v", err)
+	}
+	if !pubsub.IsPaused() {
+		t.Error("IsPaused() = false after Pause, want true")
+	}
+	if err := pubsub.Pause(context.Background()); err != nil {
+		t.Errorf("second Pause returned error: %v", err)
+	}
+
+	if err := pubsub.Resume(context.Background()); err != nil {
+		t.Fatalf("Resume returned error: %v", err)
+	}
+	if pubsub.IsPaused() {
+		t.Error("IsPaused() = true after Resume, want false")
+	}
+}
+
+func TestCbPubSub_Pause_RollsBackOnError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	mockRepo.EXPECT().
+		UpsertPath(gomock.Any(), constant.AssignmentDocName, gomock.Any(), true).
+		Return(errors.New("upsert failed"))
+
+	if err := pubsub.Pause(context.Background()); err == nil {
+		t.Error("Pause should return error when membership update fails")
+	}
+	if pubsub.IsPaused() {
+		t.Error("IsPaused() = true after failed Pause, want false")
+	}
+}
+
+func TestCbPubSub_Poll_Paused(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.paused.Store(true)
+
+	mockRepo.EXPECT().Touch(gomock.Any(), pubsub.selfDocId, gomock.Any()).Return(nil)
+
+	err := pollOnce(pubsub, func(ctx context.Context, messages []string) error {
+		t.Error("handler should not be called while paused")
+		return nil
+	})
+	if err != nil {
+		t.Errorf("poll returned error: %v", err)
+	}
+}
+
+func TestCbPubSub_Assign_KeepsPausedState(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.paused.Store(true)
+
+	mockRepo.EXPECT().Upsert(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).Return(nil)
+	mockRepo.EXPECT().
+		UpsertPath(gomock.Any(), constant.AssignmentDocName, util.GetAssignmentPath(pubsub.channel, pubsub.instanceId), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key, path string, value interface{}) error {
+			entry := value.(model.AssignmentEntry)
+			if !entry.Paused {
+				t.Error("assignment entry Paused = false, want true")
+			}
+			return nil
+		})
+
+	if err := pubsub.assign(context.Background()); err != nil {
+		t.Errorf("assign returned error: %v", err)
+	}
+}
+
+func TestCbPubSub_Poll_MultipleSubscriptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	mockRepo.EXPECT().
+		GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
+			doc := result.(*model.PubSubDoc[model.Message])
+			doc.Messages = []model.Message{testEnvelope(t, "msg1", nil), testEnvelope(t, "msg2", nil)}
+			return gocb.Cas(1), nil
+		}).
+		Times(2)
+
+	var failing atomic.Bool
+	failing.Store(true)
+	var firstCalls, secondCalls atomic.Int32
+	pubsub.addSubscription(context.Background(), func(ctx context.Context, messages []string) error {
+		firstCalls.Add(1)
+		return nil
+	})
+	pubsub.addSubscription(context.Background(), func(ctx context.Context, messages []string) error {
+		secondCalls.Add(1)
+		if failing.Load() {
+			return errors.New("handler error")
+		}
+		return nil
+	})
+
+	if _, err := pubsub.poll(context.Background()); err != nil {
+		t.Fatalf("poll returned error: %v", err)
+	}
+
+	expectAck(mockRepo, pubsub.selfDocId, 0, 2).
+		Return(nil)
+	failing.Store(false)
+
+	if _, err := pubsub.poll(context.Background()); err != nil {
+		t.Fatalf("poll returned error: %v", err)
+	}
+
+	if firstCalls.Load() != 1 {
+		t.Errorf("first handler called %d times, want 1", firstCalls.Load())
+	}
+	if secondCalls.Load() != 2 {
+		t.Errorf("second handler called %d times, want 2", secondCalls.Load())
+	}
+	for _, sub := range pubsub.activeSubscriptions() {
+		if sub.offset != 0 {
+			t.Errorf("subscription offset = %d, want 0 after removal", sub.offset)
+		}
+	}
+}
+
+func TestCbPubSub_Subscribe_Multiple(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+
+	mockRepo.EXPECT().
+		GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+		Return(gocb.Cas(1), nil).
+		AnyTimes()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- pubsub.Subscribe(ctx, func(ctx context.Context, messages []string) error {
+				return nil
+			})
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if len(pubsub.activeSubscriptions()) != 2 {
+		t.Errorf("active subscriptions = %d, want 2", len(pubsub.activeSubscriptions()))
+	}
+
+	cancel()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; !errors.Is(err, context.Canceled) {
+			t.Errorf("Subscribe error = %v, want %v", err, context.Canceled)
+		}
+	}
+	if len(pubsub.activeSubscriptions()) != 0 {
+		t.Errorf("active subscriptions = %d, want 0", len(pubsub.activeSubscriptions()))
+	}
+}
+
+func TestCbPubSub_Subscribe_RestartsFailedLoop(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.subscribeRetryConfig.MaxRetries = 0
+	pubsub.cfg.MinPollInterval = 10 * time.Millisecond
+
+	gomock.InOrder(
+		mockRepo.EXPECT().
+			GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+			Return(gocb.Cas(0), errors.New("connection lost")),
+		mockRepo.EXPECT().
+			GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+			Return(gocb.Cas(1), nil).
+			AnyTimes(),
+	)
+
+	handler := func(ctx context.Context, messages []string) error {
+		return nil
+	}
+	if err := pubsub.Subscribe(context.Background(), handler); err == nil {
+		t.Fatal("first Subscribe should return the poll error")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := pubsub.Subscribe(ctx, handler); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("second Subscribe error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestCbPubSub_Subscribe_AfterClose(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.shutdownMgr.cancel()
+
+	err := pubsub.Subscribe(context.Background(), func(ctx context.Context, messages []string) error {
+		return nil
+	})
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("Subscribe error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestCbPubSub_NextPollInterval(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.MinPollInterval = 100 * time.Millisecond
+	pubsub.cfg.MaxPollInterval = time.Second
+
+	tests := []struct {
+		name     string
+		current  time.Duration
+		received bool
+		expected time.Duration
+	}{
+		{name: "backs off when empty", current: 100 * time.Millisecond, received: false, expected: 200 * time.Millisecond},
+		{name: "capped at max", current: 800 * time.Millisecond, received: false, expected: time.Second},
+		{name: "stays at max", current: time.Second, received: false, expected: time.Second},
+		{name: "snaps back on messages", current: time.Second, received: true, expected: 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := pubsub.nextPollInterval(tt.current, tt.received)
+			if result != tt.expected {
+				t.Errorf("nextPollInterval(%v, %v) = %v, want %v", tt.current, tt.received, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCbPubSub_Poll_ReportsReceived(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.addSubscription(context.Background(), func(ctx context.Context, messages []string) error {
+		return nil
+	})
+
+	gomock.InOrder(
+		mockRepo.EXPECT().
+			GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+			Return(gocb.Cas(1), nil),
+		mockRepo.EXPECT().
+			GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
+				doc := result.(*model.PubSubDoc[model.Message])
+				doc.Messages = []model.Message{testEnvelope(t, "msg1", nil)}
+				return gocb.Cas(1), nil
+			}),
+	)
+	expectAck(mockRepo, pubsub.selfDocId, 0, 1).
+		Return(nil)
+
+	received, err := pubsub.poll(context.Background())
+	if err != nil || received {
+		t.Errorf("poll on empty document = %v, %v, want false, nil", received, err)
+	}
+	received, err = pubsub.poll(context.Background())
+	if err != nil || !received {
+		t.Errorf("poll with messages = %v, %v, want true, nil", received, err)
+	}
+}
+
+func TestCbPubSub_Subscribe_WakesOnChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.cfg.MinPollInterval = time.Hour
+	pubsub.cfg.MaxPollInterval = time.Hour
+	changes := notifier.NewInProcess()
+	defer changes.Close()
+	pubsub.notifier = changes
+
+	mockRepo.EXPECT().
+		GetAndTouch(gomock.Any(), pubsub.selfDocId, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
+			doc := result.(*model.PubSubDoc[model.Message])
+			doc.Messages = []model.Message{testEnvelope(t, "msg1", nil)}
+			return gocb.Cas(1), nil
+		})
+	removed := make(chan struct{})
+	expectAck(mockRepo, pubsub.selfDocId, 0, 1).
+		DoAndReturn(func(ctx context.Context, key, path, seqPath string, count int, cas gocb.Cas) error {
+			close(removed)
+			return nil
+		})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := make(chan string, 1)
+	go func() {
+		_ = pubsub.Subscribe(ctx, func(ctx context.Context, messages []string) error {
+			received <- messages[0]
+			return nil
+		})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	changes.Notify(pubsub.selfDocId)
+
+	select {
+	case msg := <-received:
+		if msg != "msg1" {
+			t.Errorf("received %s, want msg1", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber was not woken by change notification")
+	}
+	<-removed
+}
+
+func TestCbPubSub_Publish_NotifiesMembers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	changes := notifier.NewInProcess()
+	defer changes.Close()
+	pubsub.notifier = changes
+
+	watched, stop := changes.Watch(constant.SelfDocPrefix + "other-instance")
+	defer stop()
+
+	expectAssignmentDoc(mockRepo, model.AssignmentDoc{
+		"test-channel": {
+			"other-instance": {Timestamp: 1234567890},
+		},
+	})
+	mockRepo.EXPECT().
+		ArrayAppend(gomock.Any(), constant.SelfDocPrefix+"other-instance", constant.MessagesPath, gomock.Any()).
+		Return(nil)
+
+	if err := pubsub.Publish(context.Background(), "test-message"); err != nil {
+		t.Fatalf("Publish returned error: %v", err)
+	}
+
+	select {
+	case <-watched:
+	default:
+		t.Error("member should be notified after publish")
+	}
+}
+
+func expectLease(mockRepo *mocks.MockRepository, holder string, cas gocb.Cas) {
+	mockRepo.EXPECT().
+		Get(gomock.Any(), constant.LeaderLeaseDocName, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, result interface{}) (gocb.Cas, error) {
+			*(result.(*model.LeaseDoc)) = model.LeaseDoc{Holder: holder}
+			return cas, nil
+		})
+}
+
+func TestCbPubSub_Campaign(t *testing.T) {
+	tests := []struct {
+		name        string
+		setup       func(mockRepo *mocks.MockRepository)
+		wasLeader   bool
+		expected    bool
+		expectError bool
+	}{
+		{
+			name: "acquires free lease",
+			setup: func(mockRepo *mocks.MockRepository) {
+				mockRepo.EXPECT().Insert(gomock.Any(), constant.LeaderLeaseDocName, gomock.Any(), 45*time.Second).Return(gocb.Cas(1), nil)
+			},
+			expected: true,
+		},
+		{
+			name: "renews own lease",
+			setup: func(mockRepo *mocks.MockRepository) {
+				mockRepo.EXPECT().Insert(gomock.Any(), constant.LeaderLeaseDocName, gomock.Any(), gomock.Any()).Return(gocb.Cas(0), gocb.ErrDocumentExists)
+				expectLease(mockRepo, "test-instance", gocb.Cas(7))
+				mockRepo.EXPECT().ReplaceWithCas(gomock.Any(), constant.LeaderLeaseDocName, gomock.Any(), 45*time.Second, gocb.Cas(7)).Return(nil)
+			},
+			wasLeader: true,
+			expected:  true,
+		},
+		{
+			name: "lease held by another instance",
+			setup: func(mockRepo *mocks.MockRepository) {
+				mockRepo.EXPECT().Insert(gomock.Any(), constant.LeaderLeaseDocName, gomock.Any(), gomock.Any()).Return(gocb.Cas(0), gocb.ErrDocumentExists)
+				expectLease(mockRepo, "other-instance", gocb.Cas(7))
+			},
+			wasLeader: true,
+			expected:  false,
+		},
+		{
+			name: "lost renewal race",
+			setup: func(mockRepo *mocks.MockRepository) {
+				mockRepo.EXPECT().Insert(gomock.Any(), constant.LeaderLeaseDocName, gomock.Any(), gomock.Any()).Return(gocb.Cas(0), gocb.ErrDocumentExists)
+				expectLease(mockRepo, "test-instance", gocb.Cas(7))
+				mockRepo.EXPECT().ReplaceWithCas(gomock.Any(), constant.LeaderLeaseDocName, gomock.Any(), gomock.Any(), gocb.Cas(7)).Return(gocb.ErrCasMismatch)
+			},
+			wasLeader: true,
+			expected:  false,
+		},
+		{
+			name: "insert failure steps down",
+			setup: func(mockRepo *mocks.MockRepository) {
+				mockRepo.EXPECT().Insert(gomock.Any(), constant.LeaderLeaseDocName, gomock.Any(), gomock.Any()).Return(gocb.Cas(0), errors.New("timeout"))
+			},
+			wasLeader:   true,
+			expected:    false,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			pubsub := createTestCbPubSub(t, mockRepo)
+			pubsub.leader.Store(tt.wasLeader)
+			tt.setup(mockRepo)
+
+			leader, err := pubsub.campaign(context.Background())
+			if tt.expectError && err == nil {
+				t.Error("campaign should return error")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("campaign returned error: %v", err)
+			}
+			if leader != tt.expected {
+				t.Errorf("campaign = %v, want %v", leader, tt.expected)
+			}
+			if pubsub.IsLeader() != tt.expected {
+				t.Errorf("IsLeader() = %v, want %v", pubsub.IsLeader(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestCbPubSub_Close_ReleasesLease(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	pubsub := createTestCbPubSub(t, mockRepo)
+	pubsub.leader.Store(true)
+
+	expectLease(mockRepo, "test-instance", gocb.Cas(9))
+	mockRepo.EXPECT().DeleteWithCas(gomock.Any(), constant.LeaderLeaseDocName, gocb.Cas(9)).Return(nil)
+	mockRepo.EXPECT().Delete(gomock.Any(), pubsub.selfDocId).Return(nil)
+	mockRepo.EXPECT().RemoveMultiplePaths(gomock.Any(), constant.AssignmentDocName, gomock.Any()).Return(nil)
+	mockRepo.EXPECT().Close().Return(nil)
+
+	if err := pubsub.Close(context.Background()); err != nil {
+		t.Errorf("Close returned error: %v", err)
+	}
+	if pubsub.IsLeader() {
+		t.Error("IsLeader() = true after Close, want false")
 	}
 }
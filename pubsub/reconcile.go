@@ -0,0 +1,81 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"github.com/halilbulentorhon/cb-pubsub/constant"
+	"github.com/halilbulentorhon/cb-pubsub/model"
+	util "github.com/halilbulentorhon/cb-pubsub/pkg"
+)
+
+type ReconcileReport struct {
+	RemovedEntries  []string
+	OrphanedEntries []string
+	RestoredEntries []string
+}
+
+func (r ReconcileReport) Total() int {
+	return len(r.RemovedEntries) + len(r.OrphanedEntries) + len(r.RestoredEntries)
+}
+
+func (c *cbPubSub[T]) Reconcile(ctx context.Context) (ReconcileReport, error) {
+	var report ReconcileReport
+
+	var allDoc model.AssignmentDoc
+	_, err := c.repository.Get(ctx, constant.AssignmentDocName, &allDoc)
+	if err != nil && !errors.Is(err, gocb.ErrDocumentNotFound) {
+		return report, fmt.Errorf("failed to get assignment document: %w", err)
+	}
+
+	if _, found := allDoc[c.channel][c.instanceId]; !found && !c.draining.Load() {
+		if err = c.register(ctx); err != nil {
+			return report, fmt.Errorf("failed to restore own assignment entry: %w", err)
+		}
+		report.RestoredEntries = append(report.RestoredEntries, util.GetAssignmentPath(c.channel, c.instanceId))
+	}
+
+	now := time.Now()
+	live := c.withoutExpired(allDoc, now)
+	for channel, memberMap := range allDoc {
+		for memberId, entry := range memberMap {
+			if c.isExpired(entry.Timestamp, now) {
+				report.RemovedEntries = append(report.RemovedEntries, util.GetAssignmentPath(channel, memberId))
+				continue
+			}
+
+			exists, err := c.repository.Exists(ctx, selfDocIdOf(memberId))
+			if err != nil {
+				return report, fmt.Errorf("failed to check self document: %w", err)
+			}
+			if !exists {
+				report.OrphanedEntries = append(report.OrphanedEntries, util.GetAssignmentPath(channel, memberId))
+				delete(live[channel], memberId)
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(report.RemovedEntries)+len(report.OrphanedEntries))
+	paths = append(append(paths, report.RemovedEntries...), report.OrphanedEntries...)
+	if len(paths) > 0 {
+		err = c.repository.RemoveMultiplePaths(ctx, constant.AssignmentDocName, paths)
+		if err != nil {
+			return report, fmt.Errorf("failed to remove inactive members: %w", err)
+		}
+	}
+
+	c.observeMembers(live, now)
+
+	if report.Total() > 0 {
+		c.logger.Info("reconciled membership",
+			"removed_entries", report.RemovedEntries,
+			"orphaned_entries", report.OrphanedEntries,
+			"restored_entries", report.RestoredEntries,
+			"instance_id", c.instanceId)
+	}
+
+	return report, nil
+}
@@ -2,16 +2,22 @@ package pubsub
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/halilbulentorhon/cb-pubsub/constant"
 	util "github.com/halilbulentorhon/cb-pubsub/pkg"
 )
 
+var ErrClosed = errors.New("pubsub already closed")
+
 type shutdownManager struct {
+	timeout      time.Duration
 	cancel       context.CancelFunc
 	signalCh     chan os.Signal
 	logger       util.Logger
@@ -19,19 +25,25 @@ type shutdownManager struct {
 	ctx          context.Context
 }
 
-func newShutdownManager(logger util.Logger) *shutdownManager {
+func newShutdownManager(logger util.Logger, timeout time.Duration) *shutdownManager {
 	ctx, cancel := context.WithCancel(context.Background())
-	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+	if timeout <= 0 {
+		timeout = constant.DefaultShutdownTimeout
+	}
 
 	return &shutdownManager{
-		ctx:      ctx,
-		cancel:   cancel,
-		signalCh: signalCh,
-		logger:   logger,
+		timeout: timeout,
+		ctx:     ctx,
+		cancel:  cancel,
+		logger:  logger,
 	}
 }
 
+func (sm *shutdownManager) HandleSignals() {
+	sm.signalCh = make(chan os.Signal, 1)
+	signal.Notify(sm.signalCh, syscall.SIGINT, syscall.SIGTERM)
+}
+
 func (sm *shutdownManager) Context() context.Context {
 	return sm.ctx
 }
@@ -49,8 +61,8 @@ func (sm *shutdownManager) IsClosed() bool {
 	}
 }
 
-func (sm *shutdownManager) Shutdown(cleanupFunc func(context.Context)) error {
-	var err error
+func (sm *shutdownManager) Shutdown(ctx context.Context, cleanupFunc func(context.Context) error) error {
+	err := ErrClosed
 	sm.shutdownOnce.Do(func() {
 		sm.logger.Info("graceful shutdown started")
 
@@ -59,21 +71,28 @@ func (sm *shutdownManager) Shutdown(cleanupFunc func(context.Context)) error {
 		if sm.signalCh != nil {
 			signal.Stop(sm.signalCh)
 		}
+
+		err = nil
 		if cleanupFunc != nil {
-			func() {
+			err = func() (err error) {
 				defer func() {
 					if r := recover(); r != nil {
 						sm.logger.Error("cleanup function panicked", "panic", r)
+						err = fmt.Errorf("cleanup function panicked: %v", r)
 					}
 				}()
 
-				shutdownCtx, cancel := context.WithTimeout(context.Background(), constant.DefaultShutdownTimeout)
+				shutdownCtx, cancel := context.WithTimeout(ctx, sm.timeout)
 				defer cancel()
-				cleanupFunc(shutdownCtx)
+				return cleanupFunc(shutdownCtx)
 			}()
 		}
 
-		sm.logger.Info("graceful shutdown completed")
+		if err != nil {
+			sm.logger.Warn("graceful shutdown completed with errors", "error", err)
+		} else {
+			sm.logger.Info("graceful shutdown completed")
+		}
 	})
 	return err
 }
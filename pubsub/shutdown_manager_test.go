@@ -2,16 +2,19 @@ package pubsub
 
 import (
 	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/halilbulentorhon/cb-pubsub/constant"
 	util "github.com/halilbulentorhon/cb-pubsub/pkg"
 )
 
 func TestNewShutdownManager(t *testing.T) {
 	logger := util.NewLogger("test")
-	sm := newShutdownManager(logger)
+	sm := newShutdownManager(logger, constant.DefaultShutdownTimeout)
 
 	if sm == nil {
 		t.Fatal("shutdown manager should not be nil")
@@ -21,8 +24,8 @@ func TestNewShutdownManager(t *testing.T) {
 		t.Fatal("context should not be nil")
 	}
 
-	if sm.SignalChannel() == nil {
-		t.Fatal("signal channel should not be nil")
+	if sm.SignalChannel() != nil {
+		t.Fatal("signal channel should be nil until signal handling is enabled")
 	}
 
 	if sm.IsClosed() {
@@ -32,13 +35,13 @@ func TestNewShutdownManager(t *testing.T) {
 
 func TestShutdownManager_IsClosed(t *testing.T) {
 	logger := util.NewLogger("test")
-	sm := newShutdownManager(logger)
+	sm := newShutdownManager(logger, constant.DefaultShutdownTimeout)
 
 	if sm.IsClosed() {
 		t.Fatal("should not be closed initially")
 	}
 
-	err := sm.Shutdown(nil)
+	err := sm.Shutdown(context.Background(), nil)
 	if err != nil {
 		t.Fatalf("shutdown should not return error: %v", err)
 	}
@@ -50,7 +53,7 @@ func TestShutdownManager_IsClosed(t *testing.T) {
 
 func TestShutdownManager_Context(t *testing.T) {
 	logger := util.NewLogger("test")
-	sm := newShutdownManager(logger)
+	sm := newShutdownManager(logger, constant.DefaultShutdownTimeout)
 
 	ctx := sm.Context()
 	if ctx == nil {
@@ -63,7 +66,7 @@ func TestShutdownManager_Context(t *testing.T) {
 	default:
 	}
 
-	err := sm.Shutdown(nil)
+	err := sm.Shutdown(context.Background(), nil)
 	if err != nil {
 		t.Fatalf("shutdown should not return error: %v", err)
 	}
@@ -77,24 +80,28 @@ func TestShutdownManager_Context(t *testing.T) {
 
 func TestShutdownManager_ShutdownOnce(t *testing.T) {
 	logger := util.NewLogger("test")
-	sm := newShutdownManager(logger)
+	sm := newShutdownManager(logger, constant.DefaultShutdownTimeout)
 
 	var cleanupCallCount int
 	var mu sync.Mutex
 
-	cleanupFunc := func(ctx context.Context) {
+	cleanupFunc := func(ctx context.Context) error {
 		mu.Lock()
 		cleanupCallCount++
 		mu.Unlock()
+		return nil
 	}
 
+	var closedCount atomic.Int32
 	var wg sync.WaitGroup
 	for i := 0; i < 10; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			err := sm.Shutdown(cleanupFunc)
-			if err != nil {
+			err := sm.Shutdown(context.Background(), cleanupFunc)
+			if errors.Is(err, ErrClosed) {
+				closedCount.Add(1)
+			} else if err != nil {
 				t.Errorf("shutdown should not return error: %v", err)
 			}
 		}()
@@ -102,6 +109,10 @@ func TestShutdownManager_ShutdownOnce(t *testing.T) {
 
 	wg.Wait()
 
+	if closedCount.Load() != 9 {
+		t.Fatalf("repeated shutdowns should return ErrClosed, got %d of 9", closedCount.Load())
+	}
+
 	mu.Lock()
 	if cleanupCallCount != 1 {
 		t.Fatalf("cleanup should be called exactly once, got %d", cleanupCallCount)
@@ -115,12 +126,12 @@ func TestShutdownManager_ShutdownOnce(t *testing.T) {
 
 func TestShutdownManager_CleanupWithTimeout(t *testing.T) {
 	logger := util.NewLogger("test")
-	sm := newShutdownManager(logger)
+	sm := newShutdownManager(logger, constant.DefaultShutdownTimeout)
 
 	var cleanupCalled bool
 	var cleanupContext context.Context
 
-	cleanupFunc := func(ctx context.Context) {
+	cleanupFunc := func(ctx context.Context) error {
 		cleanupCalled = true
 		cleanupContext = ctx
 
@@ -132,9 +143,10 @@ func TestShutdownManager_CleanupWithTimeout(t *testing.T) {
 		if time.Until(deadline) > 11*time.Second || time.Until(deadline) < 9*time.Second {
 			t.Error("cleanup context should have ~10 second timeout")
 		}
+		return nil
 	}
 
-	err := sm.Shutdown(cleanupFunc)
+	err := sm.Shutdown(context.Background(), cleanupFunc)
 	if err != nil {
 		t.Fatalf("shutdown should not return error: %v", err)
 	}
@@ -150,7 +162,9 @@ func TestShutdownManager_CleanupWithTimeout(t *testing.T) {
 
 func TestShutdownManager_SignalChannel(t *testing.T) {
 	logger := util.NewLogger("test")
-	sm := newShutdownManager(logger)
+	sm := newShutdownManager(logger, constant.DefaultShutdownTimeout)
+	sm.HandleSignals()
+	defer sm.Shutdown(context.Background(), nil)
 
 	sigCh := sm.SignalChannel()
 	if sigCh == nil {
@@ -166,9 +180,9 @@ func TestShutdownManager_SignalChannel(t *testing.T) {
 
 func TestShutdownManager_NoCleanupFunction(t *testing.T) {
 	logger := util.NewLogger("test")
-	sm := newShutdownManager(logger)
+	sm := newShutdownManager(logger, constant.DefaultShutdownTimeout)
 
-	err := sm.Shutdown(nil)
+	err := sm.Shutdown(context.Background(), nil)
 	if err != nil {
 		t.Fatalf("shutdown should not return error: %v", err)
 	}
@@ -180,9 +194,9 @@ func TestShutdownManager_NoCleanupFunction(t *testing.T) {
 
 func TestShutdownManager_CleanupPanic(t *testing.T) {
 	logger := util.NewLogger("test")
-	sm := newShutdownManager(logger)
+	sm := newShutdownManager(logger, constant.DefaultShutdownTimeout)
 
-	cleanupFunc := func(ctx context.Context) {
+	cleanupFunc := func(ctx context.Context) error {
 		panic("cleanup panic")
 	}
 
@@ -192,9 +206,9 @@ func TestShutdownManager_CleanupPanic(t *testing.T) {
 		}
 	}()
 
-	err := sm.Shutdown(cleanupFunc)
-	if err != nil {
-		t.Fatalf("shutdown should not return error: %v", err)
+	err := sm.Shutdown(context.Background(), cleanupFunc)
+	if err == nil {
+		t.Fatal("shutdown should report a panicking cleanup function")
 	}
 
 	if !sm.IsClosed() {
@@ -204,7 +218,7 @@ func TestShutdownManager_CleanupPanic(t *testing.T) {
 
 func TestShutdownManager_IntegrationTest(t *testing.T) {
 	logger := util.NewLogger("test")
-	sm := newShutdownManager(logger)
+	sm := newShutdownManager(logger, constant.DefaultShutdownTimeout)
 
 	var cleanupCalled bool
 	var mu sync.Mutex
@@ -219,15 +233,16 @@ func TestShutdownManager_IntegrationTest(t *testing.T) {
 		}
 	}()
 
-	cleanupFunc := func(ctx context.Context) {
+	cleanupFunc := func(ctx context.Context) error {
 		mu.Lock()
 		cleanupCalled = true
 		mu.Unlock()
+		return nil
 	}
 
 	go func() {
 		time.Sleep(100 * time.Millisecond)
-		err := sm.Shutdown(cleanupFunc)
+		err := sm.Shutdown(context.Background(), cleanupFunc)
 		if err != nil {
 			t.Errorf("shutdown should not return error: %v", err)
 		}
@@ -252,3 +267,65 @@ func TestShutdownManager_IntegrationTest(t *testing.T) {
 		t.Fatal("should be closed after shutdown")
 	}
 }
+
+func TestShutdownManager_ConfiguredTimeout(t *testing.T) {
+	logger := util.NewLogger("test")
+	sm := newShutdownManager(logger, 2*time.Second)
+
+	err := sm.Shutdown(context.Background(), func(ctx context.Context) error {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Fatal("cleanup context should have deadline")
+		}
+		if remaining := time.Until(deadline); remaining > 2*time.Second || remaining < time.Second {
+			t.Errorf("cleanup deadline in %v, want ~2s", remaining)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("shutdown should not return error: %v", err)
+	}
+}
+
+func TestShutdownManager_CallerContextBoundsCleanup(t *testing.T) {
+	logger := util.NewLogger("test")
+	sm := newShutdownManager(logger, constant.DefaultShutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := sm.Shutdown(ctx, func(ctx context.Context) error {
+		deadline, _ := ctx.Deadline()
+		if time.Until(deadline) > 100*time.Millisecond {
+			t.Errorf("cleanup deadline in %v, want caller deadline", time.Until(deadline))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("shutdown should not return error: %v", err)
+	}
+}
+
+func TestShutdownManager_CleanupError(t *testing.T) {
+	logger := util.NewLogger("test")
+	sm := newShutdownManager(logger, constant.DefaultShutdownTimeout)
+
+	expectedErr := errors.New("cleanup failed")
+	err := sm.Shutdown(context.Background(), func(ctx context.Context) error {
+		return expectedErr
+	})
+	if !errors.Is(err, expectedErr) {
+		t.Fatalf("shutdown error = %v, want %v", err, expectedErr)
+	}
+
+	err = sm.Shutdown(context.Background(), nil)
+	if !errors.Is(err, ErrClosed) {
+		t.Fatalf("second shutdown error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestErrShutdown_WrapsErrClosed(t *testing.T) {
+	if !errors.Is(ErrShutdown, ErrClosed) {
+		t.Errorf("errors.Is(ErrShutdown, ErrClosed) = false, want true")
+	}
+}
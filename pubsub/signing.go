@@ -0,0 +1,84 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/halilbulentorhon/cb-pubsub/model"
+	util "github.com/halilbulentorhon/cb-pubsub/pkg"
+)
+
+var (
+	ErrUnsignedMessage  = errors.New("message is not signed")
+	ErrInvalidSignature = errors.New("message signature is invalid")
+)
+
+type SignaturePolicy int
+
+const (
+	SignaturePolicyDrop SignaturePolicy = iota
+	SignaturePolicyDeadLetter
+)
+
+type SigningConfig struct {
+	Keys   map[string][]byte
+	KeyId  string
+	Policy SignaturePolicy
+}
+
+func (c *cbPubSub[T]) sign(envelope *model.Message) error {
+	key, found := c.signing.Keys[c.signing.KeyId]
+	if !found {
+		return fmt.Errorf("signing key %q not found", c.signing.KeyId)
+	}
+
+	envelope.SignatureKeyId = c.signing.KeyId
+	envelope.Signature = util.Sign(key, signingPayload(*envelope))
+	return nil
+}
+
+func (c *cbPubSub[T]) verify(envelope model.Message) error {
+	if len(envelope.Signature) == 0 {
+		return ErrUnsignedMessage
+	}
+
+	key, found := c.signing.Keys[envelope.SignatureKeyId]
+	if !found {
+		return fmt.Errorf("%w: unknown signing key %q", ErrInvalidSignature, envelope.SignatureKeyId)
+	}
+
+	if !util.VerifySignature(key, signingPayload(envelope), envelope.Signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func signingPayload(envelope model.Message) []byte {
+	var buf bytes.Buffer
+	writeField := func(value []byte) {
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(value)))
+		buf.Write(value)
+	}
+
+	writeField([]byte(envelope.SignatureKeyId))
+	writeField([]byte(envelope.Codec))
+	writeField([]byte(envelope.Encoding))
+	writeField([]byte(envelope.KeyId))
+
+	headerNames := make([]string, 0, len(envelope.Headers))
+	for name := range envelope.Headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(headerNames)))
+	for _, name := range headerNames {
+		writeField([]byte(name))
+		writeField([]byte(envelope.Headers[name]))
+	}
+
+	writeField(envelope.Payload)
+	return buf.Bytes()
+}
@@ -0,0 +1,124 @@
+package pubsub
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/halilbulentorhon/cb-pubsub/model"
+)
+
+type subscription[T any] struct {
+	ctx     context.Context
+	handler PubSubHandler[T]
+	offset  int
+	mu      sync.Mutex
+	closed  bool
+}
+
+type pollLoop struct {
+	done chan struct{}
+	err  error
+}
+
+func (c *cbPubSub[T]) addSubscription(ctx context.Context, handler PubSubHandler[T]) *subscription[T] {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	sub := &subscription[T]{ctx: ctx, handler: handler}
+	c.subscriptions = append(c.subscriptions, sub)
+	return sub
+}
+
+func (c *cbPubSub[T]) removeSubscription(sub *subscription[T]) {
+	c.subsMu.Lock()
+	for i, s := range c.subscriptions {
+		if s == sub {
+			c.subscriptions = append(c.subscriptions[:i], c.subscriptions[i+1:]...)
+			break
+		}
+	}
+	c.subsMu.Unlock()
+
+	sub.mu.Lock()
+	sub.closed = true
+	sub.mu.Unlock()
+}
+
+func (c *cbPubSub[T]) activeSubscriptions() []*subscription[T] {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	subs := make([]*subscription[T], len(c.subscriptions))
+	copy(subs, c.subscriptions)
+	return subs
+}
+
+func (c *cbPubSub[T]) subscribe(ctx context.Context, handler PubSubHandler[T]) (*subscription[T], *pollLoop) {
+	sub := c.addSubscription(ctx, handler)
+
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	if c.loop == nil {
+		c.loop = &pollLoop{done: make(chan struct{})}
+		go c.runPollLoop(c.loop)
+	}
+	return sub, c.loop
+}
+
+func (c *cbPubSub[T]) runPollLoop(loop *pollLoop) {
+	defer close(loop.done)
+	loop.err = c.doSubscribe(loop)
+
+	c.subsMu.Lock()
+	if c.loop == loop {
+		c.loop = nil
+	}
+	c.subsMu.Unlock()
+}
+
+func (c *cbPubSub[T]) stopIfIdle(loop *pollLoop) bool {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	if len(c.subscriptions) > 0 {
+		return false
+	}
+	if c.loop == loop {
+		c.loop = nil
+	}
+	return true
+}
+
+func (c *cbPubSub[T]) fanOut(envelopes []model.Message, subs []*subscription[T], messages []T, positions []int) int {
+	total := len(envelopes)
+
+	var wg sync.WaitGroup
+	for _, sub := range subs {
+		start := sort.SearchInts(positions, sub.offset)
+		if start == len(positions) {
+			sub.offset = total
+			continue
+		}
+
+		wg.Add(1)
+		go func(sub *subscription[T], start int) {
+			defer wg.Done()
+			sub.mu.Lock()
+			defer sub.mu.Unlock()
+			if sub.closed {
+				sub.offset = total
+				return
+			}
+			sub.offset = max(sub.offset, c.dispatch(sub.ctx, sub.handler, messages[start:], positions[start:], total))
+		}(sub, start)
+	}
+	wg.Wait()
+
+	completed := total
+	for _, sub := range subs {
+		completed = min(completed, sub.offset)
+	}
+	return completed
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -29,6 +30,17 @@ func (r *couchbaseRepository) Get(ctx context.Context, key string, result interf
 	return getResult.Cas(), nil
 }
 
+func (r *couchbaseRepository) Exists(ctx context.Context, key string) (bool, error) {
+	result, err := r.collection.Exists(key, &gocb.ExistsOptions{
+		Context: ctx,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check existence of document with key %s: %w", key, err)
+	}
+
+	return result.Exists(), nil
+}
+
 func (r *couchbaseRepository) GetAndTouch(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error) {
 	getResult, err := r.collection.GetAndTouch(key, ttl, &gocb.GetAndTouchOptions{
 		Context: ctx,
@@ -45,6 +57,17 @@ func (r *couchbaseRepository) GetAndTouch(ctx context.Context, key string, resul
 	return getResult.Cas(), nil
 }
 
+func (r *couchbaseRepository) Touch(ctx context.Context, key string, ttl time.Duration) error {
+	_, err := r.collection.Touch(key, ttl, &gocb.TouchOptions{
+		Context: ctx,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to touch document with key %s: %w", key, err)
+	}
+
+	return nil
+}
+
 func (r *couchbaseRepository) Upsert(ctx context.Context, key string, document interface{}, ttl time.Duration) error {
 	opts := &gocb.UpsertOptions{
 		Context: ctx,
@@ -61,6 +84,22 @@ func (r *couchbaseRepository) Upsert(ctx context.Context, key string, document i
 	return nil
 }
 
+func (r *couchbaseRepository) Insert(ctx context.Context, key string, document interface{}, ttl time.Duration) (gocb.Cas, error) {
+	opts := &gocb.InsertOptions{
+		Context: ctx,
+	}
+	if ttl > 0 {
+		opts.Expiry = ttl
+	}
+
+	result, err := r.collection.Insert(key, document, opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert document with key '%s': %w", key, err)
+	}
+
+	return result.Cas(), nil
+}
+
 func (r *couchbaseRepository) ReplaceWithCas(ctx context.Context, key string, document interface{}, ttl time.Duration, cas gocb.Cas) error {
 	opts := &gocb.ReplaceOptions{
 		Cas:     cas,
@@ -125,6 +164,141 @@ func (r *couchbaseRepository) ArrayAppend(ctx context.Context, key string, path
 	return nil
 }
 
+func (r *couchbaseRepository) ArrayCount(ctx context.Context, key string, path string) (int, error) {
+	result, err := r.collection.LookupIn(key, []gocb.LookupInSpec{
+		gocb.CountSpec(path, &gocb.CountSpecOptions{}),
+	}, &gocb.LookupInOptions{
+		Context: ctx,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count array at path '%s' in document with key '%s': %w", path, key, err)
+	}
+
+	var count int
+	err = result.ContentAt(0, &count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read array count at path '%s' in document with key '%s': %w", path, key, err)
+	}
+
+	return count, nil
+}
+
+func (r *couchbaseRepository) ArrayGetRange(ctx context.Context, key string, path string, seqPath string, fromIndex int, toIndex int) ([]json.RawMessage, ArrayState, error) {
+	specs := append([]gocb.LookupInSpec{
+		gocb.CountSpec(path, &gocb.CountSpecOptions{}),
+		gocb.GetSpec(seqPath, &gocb.GetSpecOptions{}),
+	}, arrayElementSpecs(path, fromIndex, toIndex, constant.MaxSubDocSpecs-2)...)
+
+	result, err := r.collection.LookupIn(key, specs, &gocb.LookupInOptions{
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, ArrayState{}, fmt.Errorf("failed to look up range %d to %d of array at path '%s' in document with key '%s': %w", fromIndex, toIndex, path, key, err)
+	}
+
+	state := ArrayState{Seq: sequenceAt(result, 1), Cas: result.Cas()}
+	err = result.ContentAt(0, &state.Count)
+	if err != nil {
+		return nil, ArrayState{}, fmt.Errorf("failed to read array count at path '%s' in document with key '%s': %w", path, key, err)
+	}
+
+	if toIndex >= state.Count {
+		toIndex = state.Count - 1
+	}
+
+	items := make([]json.RawMessage, 0)
+	batchStart, specOffset := fromIndex, 2
+	for i := fromIndex; i <= toIndex; i++ {
+		specIndex := i - batchStart + specOffset
+		if specIndex >= len(specs) {
+			specs = append([]gocb.LookupInSpec{gocb.GetSpec(seqPath, &gocb.GetSpecOptions{})},
+				arrayElementSpecs(path, i, toIndex, constant.MaxSubDocSpecs-1)...)
+			result, err = r.collection.LookupIn(key, specs, &gocb.LookupInOptions{
+				Context: ctx,
+			})
+			if err != nil {
+				return nil, ArrayState{}, fmt.Errorf("failed to look up range %d to %d of array at path '%s' in document with key '%s': %w", i, toIndex, path, key, err)
+			}
+			if sequenceAt(result, 0) != state.Seq {
+				return items, state, nil
+			}
+			batchStart, specOffset, specIndex = i, 1, 1
+		}
+
+		var item json.RawMessage
+		err = result.ContentAt(uint(specIndex), &item)
+		if err != nil {
+			return nil, ArrayState{}, fmt.Errorf("failed to read element %d of array at path '%s' in document with key '%s': %w", i, path, key, err)
+		}
+		items = append(items, item)
+	}
+
+	return items, state, nil
+}
+
+func (r *couchbaseRepository) ArrayHeadState(ctx context.Context, key string, path string, seqPath string) (ArrayState, error) {
+	result, err := r.collection.LookupIn(key, []gocb.LookupInSpec{
+		gocb.CountSpec(path, &gocb.CountSpecOptions{}),
+		gocb.GetSpec(seqPath, &gocb.GetSpecOptions{}),
+	}, &gocb.LookupInOptions{
+		Context: ctx,
+	})
+	if err != nil {
+		return ArrayState{}, fmt.Errorf("failed to look up head of array at path '%s' in document with key '%s': %w", path, key, err)
+	}
+
+	state := ArrayState{Seq: sequenceAt(result, 1), Cas: result.Cas()}
+	err = result.ContentAt(0, &state.Count)
+	if err != nil {
+		return ArrayState{}, fmt.Errorf("failed to read array count at path '%s' in document with key '%s': %w", path, key, err)
+	}
+
+	return state, nil
+}
+
+func (r *couchbaseRepository) ArrayRemoveHead(ctx context.Context, key string, path string, seqPath string, count int, cas gocb.Cas) error {
+	if count <= 0 {
+		return nil
+	}
+	if count > constant.MaxSubDocSpecs-1 {
+		return fmt.Errorf("cannot remove %d elements from array at path '%s' in one operation, limit is %d", count, path, constant.MaxSubDocSpecs-1)
+	}
+
+	specs := make([]gocb.MutateInSpec, 0, count+1)
+	for i := 0; i < count; i++ {
+		specs = append(specs, gocb.RemoveSpec(fmt.Sprintf("%s[0]", path), &gocb.RemoveSpecOptions{}))
+	}
+	specs = append(specs, gocb.IncrementSpec(seqPath, int64(count), &gocb.CounterSpecOptions{}))
+
+	_, err := r.collection.MutateIn(key, specs, &gocb.MutateInOptions{
+		StoreSemantic:  gocb.StoreSemanticsReplace,
+		Cas:            cas,
+		PreserveExpiry: true,
+		Context:        ctx,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove %d elements from head of array at path '%s' in document with key '%s': %w", count, path, key, err)
+	}
+
+	return nil
+}
+
+func sequenceAt(result *gocb.LookupInResult, index uint) int64 {
+	var seq int64
+	if err := result.ContentAt(index, &seq); err != nil {
+		return 0
+	}
+	return seq
+}
+
+func arrayElementSpecs(path string, fromIndex int, toIndex int, limit int) []gocb.LookupInSpec {
+	specs := make([]gocb.LookupInSpec, 0, limit)
+	for i := fromIndex; i <= toIndex && len(specs) < limit; i++ {
+		specs = append(specs, gocb.GetSpec(fmt.Sprintf("%s[%d]", path, i), &gocb.GetSpecOptions{}))
+	}
+	return specs
+}
+
 func (r *couchbaseRepository) RemoveMultiplePaths(ctx context.Context, key string, paths []string) error {
 	if len(paths) == 0 {
 		return fmt.Errorf("no paths provided")
@@ -185,6 +359,18 @@ func (r *couchbaseRepository) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+func (r *couchbaseRepository) DeleteWithCas(ctx context.Context, key string, cas gocb.Cas) error {
+	_, err := r.collection.Remove(key, &gocb.RemoveOptions{
+		Cas:     cas,
+		Context: ctx,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete document with key %s and cas %d: %w", key, cas, err)
+	}
+
+	return nil
+}
+
 func (r *couchbaseRepository) Close() error {
 	if r.cluster != nil {
 		return r.cluster.Close(nil)
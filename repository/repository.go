@@ -2,20 +2,35 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"github.com/couchbase/gocb/v2"
 	"time"
 )
 
 type Repository interface {
 	Get(ctx context.Context, key string, result interface{}) (gocb.Cas, error)
+	Exists(ctx context.Context, key string) (bool, error)
 	GetAndTouch(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error)
+	Touch(ctx context.Context, key string, ttl time.Duration) error
 	Upsert(ctx context.Context, key string, document interface{}, ttl time.Duration) error
+	Insert(ctx context.Context, key string, document interface{}, ttl time.Duration) (gocb.Cas, error)
 	ReplaceWithCas(ctx context.Context, key string, document interface{}, ttl time.Duration, cas gocb.Cas) error
 	UpsertPath(ctx context.Context, key string, path string, value interface{}) error
 	UpsertPathWithCas(ctx context.Context, key string, path string, value interface{}, cas gocb.Cas) error
 	ArrayAppend(ctx context.Context, key string, path string, values interface{}) error
+	ArrayCount(ctx context.Context, key string, path string) (int, error)
+	ArrayGetRange(ctx context.Context, key string, path string, seqPath string, fromIndex int, toIndex int) ([]json.RawMessage, ArrayState, error)
+	ArrayHeadState(ctx context.Context, key string, path string, seqPath string) (ArrayState, error)
+	ArrayRemoveHead(ctx context.Context, key string, path string, seqPath string, count int, cas gocb.Cas) error
 	RemoveMultiplePaths(ctx context.Context, key string, paths []string) error
 	ArrayRemoveFromIndex(ctx context.Context, key string, path string, fromIndex int, toIndex int) error
 	Delete(ctx context.Context, key string) error
+	DeleteWithCas(ctx context.Context, key string, cas gocb.Cas) error
 	Close() error
 }
+
+type ArrayState struct {
+	Count int
+	Seq   int64
+	Cas   gocb.Cas
+}
@@ -30,15 +30,23 @@ func TestRepositoryInterface_MethodSignatures(t *testing.T) {
 		method string
 	}{
 		{"Get", "Get(ctx context.Context, key string, result interface{}) (gocb.Cas, error)"},
+		{"Exists", "Exists(ctx context.Context, key string) (bool, error)"},
 		{"GetAndTouch", "GetAndTouch(ctx context.Context, key string, result interface{}, ttl time.Duration) (gocb.Cas, error)"},
+		{"Touch", "Touch(ctx context.Context, key string, ttl time.Duration) error"},
 		{"Upsert", "Upsert(ctx context.Context, key string, document interface{}, ttl time.Duration) error"},
+		{"Insert", "Insert(ctx context.Context, key string, document interface{}, ttl time.Duration) (gocb.Cas, error)"},
 		{"ReplaceWithCas", "ReplaceWithCas(ctx context.Context, key string, document interface{}, ttl time.Duration, cas gocb.Cas) error"},
 		{"UpsertPath", "UpsertPath(ctx context.Context, key string, path string, value interface{}) error"},
 		{"UpsertPathWithCas", "UpsertPathWithCas(ctx context.Context, key string, path string, value interface{}, cas gocb.Cas) error"},
 		{"ArrayAppend", "ArrayAppend(ctx context.Context, key string, path string, values interface{}) error"},
+		{"ArrayCount", "ArrayCount(ctx context.Context, key string, path string) (int, error)"},
+		{"ArrayGetRange", "ArrayGetRange(ctx context.Context, key string, path string, seqPath string, fromIndex int, toIndex int) ([]json.RawMessage, ArrayState, error)"},
+		{"ArrayHeadState", "ArrayHeadState(ctx context.Context, key string, path string, seqPath string) (ArrayState, error)"},
+		{"ArrayRemoveHead", "ArrayRemoveHead(ctx context.Context, key string, path string, seqPath string, count int, cas gocb.Cas) error"},
 		{"RemoveMultiplePaths", "RemoveMultiplePaths(ctx context.Context, key string, paths []string) error"},
 		{"ArrayRemoveFromIndex", "ArrayRemoveFromIndex(ctx context.Context, key string, path string, fromIndex int, toIndex int) error"},
 		{"Delete", "Delete(ctx context.Context, key string) error"},
+		{"DeleteWithCas", "DeleteWithCas(ctx context.Context, key string, cas gocb.Cas) error"},
 		{"Close", "Close() error"},
 	}
 